@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CIProvider supplies an OIDC identity token issued by a CI system to the running job
+type CIProvider interface {
+	// Name returns a human-readable name of the CI system
+	Name() string
+	// Detect reports whether the current process runs inside this CI system
+	Detect() bool
+	// ConnectorID returns the default Dex connector used to exchange the CI token
+	ConnectorID() string
+	// Issuer returns the issuer URL of the CI ID tokens
+	Issuer() string
+	// IDToken requests an ID token for the given audience
+	IDToken(ctx context.Context, audience string) (string, error)
+}
+
+// CIProviders returns all known CI identity providers in detection order
+func CIProviders() []CIProvider {
+	return []CIProvider{
+		&githubActions{},
+		&gitlabCI{},
+		&buildkite{},
+		&circleCI{},
+	}
+}
+
+// DetectCIProvider returns the CI identity provider for the current environment.
+// name forces a provider by its connector ID; nil is returned when none is detected.
+func DetectCIProvider(name string) (CIProvider, error) {
+	for _, p := range CIProviders() {
+		if name != "" {
+			if p.ConnectorID() == name {
+				return p, nil
+			}
+			continue
+		}
+
+		if p.Detect() {
+			return p, nil
+		}
+	}
+
+	if name != "" {
+		return nil, fmt.Errorf("unknown CI provider %q", name)
+	}
+
+	return nil, nil
+}
+
+// githubActions requests ID tokens through ACTIONS_ID_TOKEN_REQUEST_*.
+// The workflow must have the "id-token: write" permission.
+type githubActions struct{}
+
+func (g *githubActions) Name() string        { return "GitHub Actions" }
+func (g *githubActions) ConnectorID() string { return "github-actions" }
+func (g *githubActions) Issuer() string      { return "https://token.actions.githubusercontent.com" }
+
+func (g *githubActions) Detect() bool {
+	return os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN") != "" && os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL") != ""
+}
+
+func (g *githubActions) IDToken(ctx context.Context, audience string) (string, error) {
+	token := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	tokenURL := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL")
+	if token == "" || tokenURL == "" {
+		return "", errors.New("ACTIONS_ID_TOKEN_REQUEST_TOKEN or ACTIONS_ID_TOKEN_REQUEST_URL is not set, is the \"id-token: write\" permission granted?")
+	}
+
+	u, err := url.Parse(tokenURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("audience", audience)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Authorization", "bearer "+token)
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request GitHub ID token: unexpected status %s", resp.Status)
+	}
+
+	var respData struct {
+		Value string `json:"value"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+		return "", err
+	}
+
+	if respData.Value == "" {
+		return "", errors.New("missing value from GitHub ID token response")
+	}
+
+	return respData.Value, nil
+}
+
+// gitlabCI reads the ID token from the job environment. The audience is set in
+// .gitlab-ci.yml through id_tokens, the variable defaults to FYVE_ID_TOKEN.
+type gitlabCI struct{}
+
+func (g *gitlabCI) Name() string        { return "GitLab CI" }
+func (g *gitlabCI) ConnectorID() string { return "gitlab" }
+
+func (g *gitlabCI) Issuer() string {
+	if val := os.Getenv("CI_SERVER_URL"); val != "" {
+		return val
+	}
+
+	return "https://gitlab.com"
+}
+
+func (g *gitlabCI) Detect() bool {
+	return os.Getenv("GITLAB_CI") == "true" && g.token() != ""
+}
+
+func (g *gitlabCI) IDToken(_ context.Context, _ string) (string, error) {
+	if token := g.token(); token != "" {
+		return token, nil
+	}
+
+	return "", errors.New("no ID token found, declare FYVE_ID_TOKEN in the job's id_tokens")
+}
+
+func (g *gitlabCI) token() string {
+	for _, name := range []string{os.Getenv("FYVE_CI_TOKEN_VAR"), "FYVE_ID_TOKEN", "CI_JOB_JWT_V2"} {
+		if name == "" {
+			continue
+		}
+
+		if val := os.Getenv(name); val != "" {
+			return val
+		}
+	}
+
+	return ""
+}
+
+// buildkite requests ID tokens through the buildkite-agent binary, with the access token the
+// agent passes to the job
+type buildkite struct{}
+
+func (b *buildkite) Name() string        { return "Buildkite" }
+func (b *buildkite) ConnectorID() string { return "buildkite" }
+func (b *buildkite) Issuer() string      { return "https://agent.buildkite.com" }
+
+func (b *buildkite) Detect() bool {
+	if os.Getenv("BUILDKITE") != "true" || os.Getenv("BUILDKITE_AGENT_ACCESS_TOKEN") == "" {
+		return false
+	}
+
+	_, err := exec.LookPath("buildkite-agent")
+	return err == nil
+}
+
+func (b *buildkite) IDToken(ctx context.Context, audience string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "buildkite-agent", "oidc", "request-token", "--audience", audience)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("buildkite-agent oidc request-token: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// circleCI reads the ID token CircleCI injects into every job. Its audience is always the organization ID.
+type circleCI struct{}
+
+func (c *circleCI) Name() string        { return "CircleCI" }
+func (c *circleCI) ConnectorID() string { return "circleci" }
+
+func (c *circleCI) Issuer() string {
+	return "https://oidc.circleci.com/org/" + os.Getenv("CIRCLE_ORGANIZATION_ID")
+}
+
+func (c *circleCI) Detect() bool {
+	return os.Getenv("CIRCLECI") == "true" && c.token() != ""
+}
+
+func (c *circleCI) IDToken(_ context.Context, _ string) (string, error) {
+	if token := c.token(); token != "" {
+		return token, nil
+	}
+
+	return "", errors.New("CIRCLE_OIDC_TOKEN_V2 is not set")
+}
+
+func (c *circleCI) token() string {
+	if val := os.Getenv("CIRCLE_OIDC_TOKEN_V2"); val != "" {
+		return val
+	}
+
+	return os.Getenv("CIRCLE_OIDC_TOKEN")
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/spf13/viper"
+)
+
+// ExchangeResult describes a successful CI token exchange
+type ExchangeResult struct {
+	Provider    string
+	ConnectorID string
+	Expiry      time.Time
+}
+
+// ExchangeCIToken exchanges the ID token of the detected CI system for a Fyve token and
+// saves it to the auth config. A nil result without error means no CI system was detected.
+func ExchangeCIToken(ctx context.Context) (*ExchangeResult, error) {
+	provider, err := DetectCIProvider(viper.GetString("oidc.ci.provider"))
+	if err != nil || provider == nil {
+		return nil, err
+	}
+
+	audience := viper.GetString("oidc.ci.audience")
+	ciToken, err := provider.IDToken(ctx, audience)
+	if err != nil {
+		return nil, fmt.Errorf("request %s ID token: %w", provider.Name(), err)
+	}
+
+	isDebug := viper.GetBool("debug")
+	if isDebug {
+		ciProvider, err := oidc.NewProvider(ctx, provider.Issuer())
+		if err != nil {
+			return nil, err
+		}
+
+		_ = printClaims(ctx, ciProvider, ciToken, provider.Name()+" claims: %s\n")
+	}
+
+	oidcIssuerURL := viper.GetString("oidc.issuer.url")
+	oidcProvider, err := oidc.NewProvider(ctx, oidcIssuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	connectorID := viper.GetString("oidc.ci.connector_id")
+	if connectorID == "" {
+		connectorID = provider.ConnectorID()
+	}
+
+	fyveToken, expiresIn, err := exchangeForFyveToken(ctx, oidcProvider.Endpoint().TokenURL, ciToken, connectorID,
+		viper.GetString("oidc.client_id"), "", viper.GetString("oidc.cross_trust_client_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if isDebug {
+		_ = printClaims(ctx, oidcProvider, fyveToken, "Fyve claims: %s\n")
+	}
+
+	result := &ExchangeResult{
+		Provider:    provider.Name(),
+		ConnectorID: connectorID,
+	}
+	if expiresIn > 0 {
+		result.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+
+	return result, config.SaveAuthConfig(config.AuthConfig{
+		AccessToken: fyveToken,
+		Expiry:      result.Expiry,
+	})
+}
+
+func exchangeForFyveToken(ctx context.Context, tokenURL, subjectToken, connectorID string, clientID, clientSecret, crossTrustClientId string) (string, int32, error) {
+	data := url.Values{}
+	data.Set("connector_id", connectorID)
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:token-exchange")
+	data.Set("scope", fmt.Sprintf("openid profile email groups federated:id audience:server:client_id:%s", crossTrustClientId))
+	data.Set("requested_token_type", "urn:ietf:params:oauth:token-type:access_token")
+	data.Set("subject_token", subjectToken)
+	data.Set("subject_token_type", "urn:ietf:params:oauth:token-type:id_token")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+
+	req.SetBasicAuth(clientID, clientSecret)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int32  `json:"expires_in"`
+		IssuedTokenType  string `json:"issued_token_type"`
+		TokenType        string `json:"token_type"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", 0, err
+	}
+
+	if tokenResp.Error != "" {
+		return "", 0, fmt.Errorf("token exchange via connector %s failed: %s: %s", connectorID, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+
+	if tokenResp.AccessToken != "" {
+		return tokenResp.AccessToken, tokenResp.ExpiresIn, nil
+	}
+
+	return "", 0, errors.New("missing access_token from exchange response")
+}
+
+func printClaims(ctx context.Context, provider *oidc.Provider, rawToken, printF string) error {
+	var claims map[string]interface{}
+	idToken, err := provider.Verifier(&oidc.Config{SkipClientIDCheck: true}).Verify(ctx, rawToken)
+	if err != nil {
+		return fmt.Errorf("oidc: failed to verify ID Token: %v", err)
+	}
+
+	if err = idToken.Claims(&claims); err != nil {
+		return fmt.Errorf("oidc: failed to decode claims: %v", err)
+	}
+
+	claimString, _ := json.Marshal(claims)
+	log.Printf(printF, claimString)
+
+	return nil
+}
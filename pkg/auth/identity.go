@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/spf13/viper"
+)
+
+// Identity holds the verified claims of the stored Fyve token
+type Identity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Groups    []string  `json:"groups"`
+	Audience  []string  `json:"audience"`
+	Expiry    time.Time `json:"expiry"`
+	Expired   bool      `json:"expired"`
+	Remaining string    `json:"remaining"`
+}
+
+// StoredIdentity verifies the stored token against the issuer and returns its claims.
+// Expired tokens are reported as such instead of failing the verification.
+func StoredIdentity(ctx context.Context) (*Identity, error) {
+	authConfig, err := config.LoadAuthConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading auth config: %w. Run \"fyve login\" to fix this issue and try again", err)
+	}
+
+	token := authConfig.IDToken
+	if token == "" {
+		token = authConfig.AccessToken
+	}
+
+	if token == "" {
+		return nil, errors.New("could not find token in auth config. Run \"fyve login\" to fix this issue and try again")
+	}
+
+	issuerURL := viper.GetString("oidc.issuer.url")
+	provider, err := oidc.NewProvider(ctx, issuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{SkipClientIDCheck: true, SkipExpiryCheck: true}).Verify(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: failed to verify token: %w", err)
+	}
+
+	var claims struct {
+		Email  string   `json:"email"`
+		Name   string   `json:"name"`
+		Groups []string `json:"groups"`
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc: failed to decode claims: %w", err)
+	}
+
+	remaining := time.Until(idToken.Expiry)
+	identity := &Identity{
+		Issuer:   idToken.Issuer,
+		Subject:  idToken.Subject,
+		Email:    claims.Email,
+		Name:     claims.Name,
+		Groups:   claims.Groups,
+		Audience: idToken.Audience,
+		Expiry:   idToken.Expiry,
+		Expired:  remaining <= 0,
+	}
+
+	if identity.Expired {
+		identity.Remaining = "0s"
+	} else {
+		identity.Remaining = remaining.Round(time.Second).String()
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/spf13/viper"
+)
+
+// RevocationEndpoint returns the RFC 7009 revocation endpoint advertised by the issuer, if any
+func RevocationEndpoint(ctx context.Context) (string, error) {
+	provider, err := oidc.NewProvider(ctx, viper.GetString("oidc.issuer.url"))
+	if err != nil {
+		return "", err
+	}
+
+	var discovery struct {
+		RevocationEndpoint string `json:"revocation_endpoint"`
+	}
+	if err = provider.Claims(&discovery); err != nil {
+		return "", err
+	}
+
+	return discovery.RevocationEndpoint, nil
+}
+
+// RevokeTokens revokes the refresh and access tokens of authConfig at endpoint and
+// returns the token types that were revoked
+func RevokeTokens(ctx context.Context, endpoint string, authConfig *config.AuthConfig) ([]string, error) {
+	tokens := []struct {
+		hint  string
+		value string
+	}{
+		{"refresh_token", authConfig.RefreshToken},
+		{"access_token", authConfig.AccessToken},
+	}
+
+	var revoked []string
+	for _, token := range tokens {
+		if token.value == "" {
+			continue
+		}
+
+		if err := revokeToken(ctx, endpoint, token.value, token.hint); err != nil {
+			return revoked, err
+		}
+
+		revoked = append(revoked, token.hint)
+	}
+
+	return revoked, nil
+}
+
+func revokeToken(ctx context.Context, endpoint, token, tokenTypeHint string) error {
+	data := url.Values{}
+	data.Set("token", token)
+	data.Set("token_type_hint", tokenTypeHint)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(viper.GetString("oidc.client_id"), "")
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Revoking an unknown or already revoked token is answered with 200 as well
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revoke %s: unexpected status %s", tokenTypeHint, resp.Status)
+	}
+
+	return nil
+}
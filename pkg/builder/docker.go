@@ -0,0 +1,96 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+)
+
+// BuildDockerfile builds image from a Dockerfile in contextDir, dockerfile defaults to <contextDir>/Dockerfile.
+// With attest, the image is built with an SBOM and provenance and pushed, see buildImage.
+func BuildDockerfile(contextDir, dockerfile, image string, attest bool) error {
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+
+	if !filepath.IsAbs(dockerfile) {
+		dockerfile = filepath.Join(contextDir, dockerfile)
+	}
+
+	if _, err := os.Stat(dockerfile); err != nil {
+		return fmt.Errorf("dockerfile not found: %w", err)
+	}
+
+	return buildImage(contextDir, dockerfile, []string{image}, attest)
+}
+
+// Push uploads a built image to its registry
+func Push(image string) error {
+	return dockerPush(image)
+}
+
+// buildImage builds dockerfile in contextDir tagged with tags. With attest, BuildKit adds an SPDX
+// SBOM and SLSA provenance and pushes the image with them, since the classic image store cannot
+// hold attestations. The provenance records the build args, the git revision and the fyve version.
+func buildImage(contextDir, dockerfile string, tags []string, attest bool) error {
+	platform := "linux/amd64"
+	if val := os.Getenv("DOCKER_BUILD_PLATFORM"); val != "" {
+		platform = val
+	}
+
+	args := []string{"build", "--platform", platform, "-f", dockerfile}
+	if attest {
+		args = append([]string{"buildx"}, args...)
+		args = append(args,
+			"--push",
+			"--sbom=true",
+			"--provenance=mode=max,builder-id="+builderID(),
+			// include the packages of the build context and of the build stages, such as node_modules
+			"--build-arg", "BUILDKIT_SBOM_SCAN_CONTEXT=true",
+			"--build-arg", "BUILDKIT_SBOM_SCAN_STAGE=true",
+			"--label", "dev.fyve.version="+config.Version(),
+		)
+
+		if revision := gitRevision(contextDir); revision != "" {
+			args = append(args, "--label", "org.opencontainers.image.revision="+revision)
+		}
+	}
+
+	for _, tag := range tags {
+		args = append(args, "-t", tag)
+	}
+	args = append(args, contextDir)
+
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// builderID identifies where the image was built in its provenance, the workflow run in GitHub Actions
+func builderID() string {
+	if runID := os.Getenv("GITHUB_RUN_ID"); runID != "" {
+		return fmt.Sprintf("%s/%s/actions/runs/%s", os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), runID)
+	}
+
+	return "https://github.com/fyve-labs/fyve-cli@" + config.Version()
+}
+
+// gitRevision returns the commit being built, empty outside a git repository
+func gitRevision(dir string) string {
+	if sha := os.Getenv("GITHUB_SHA"); sha != "" {
+		return sha
+	}
+
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
@@ -113,53 +113,69 @@ dist
 		}
 	}
 
-	platform := "linux/amd64"
-	if val := os.Getenv("DOCKER_BUILD_PLATFORM"); val != "" {
-		platform = val
+	// With attestations the image is pushed while building, tagged latest as Push would
+	tags := []string{b.config.GetImage()}
+	if b.config.Attestations() {
+		latest, err := b.latestImage()
+		if err != nil {
+			return err
+		}
+		if latest != "" {
+			tags = append(tags, latest)
+		}
 	}
 
-	// Build Docker image with platform specified
-	cmd := exec.Command("docker", "build",
-		"--platform", platform,
-		"-f", dockerfilePath,
-		"-t", b.config.GetImage(),
-		b.ProjectDir)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
+	return buildImage(b.ProjectDir, dockerfilePath, tags, b.config.Attestations())
 }
 
-// PushToECR uploads the built image to AWS ECR
-func (b *NextJSBuilder) PushToECR() error {
+// Push uploads the built image to its registry, images built with attestations are already pushed
+func (b *NextJSBuilder) Push() error {
+	if b.config.Attestations() {
+		return nil
+	}
+
 	taggedImage := b.config.GetImage()
 	err := dockerPush(taggedImage)
 	if err != nil {
 		return err
 	}
 
-	imageParts := strings.Split(taggedImage, ":")
-	if len(imageParts) != 2 {
-		return fmt.Errorf("PushToECR: invalid image format")
+	lastestImage, err := b.latestImage()
+	if err != nil || lastestImage == "" {
+		return err
 	}
 
-	imageURL := imageParts[0]
-	imageTag := imageParts[1]
-
-	if imageTag != "latest" {
-		// tag the latest image with the current image tag
-		lastestImage := imageURL + ":latest"
-		tagCmd := exec.Command("docker", "tag", taggedImage, lastestImage)
-		tagCmd.Stdout = os.Stdout
-		tagCmd.Stderr = os.Stderr
-		if err = tagCmd.Run(); err != nil {
-			return fmt.Errorf("failed to tag latest image: %w", err)
-		}
+	// tag the latest image with the current image tag
+	tagCmd := exec.Command("docker", "tag", taggedImage, lastestImage)
+	tagCmd.Stdout = os.Stdout
+	tagCmd.Stderr = os.Stderr
+	if err = tagCmd.Run(); err != nil {
+		return fmt.Errorf("failed to tag latest image: %w", err)
+	}
+
+	return dockerPush(lastestImage)
+}
+
+// latestImage returns the :latest reference moved to the built image, empty unless --push-latest
+// is set, the image is already tagged latest or the repository has immutable tags
+func (b *NextJSBuilder) latestImage() (string, error) {
+	if !b.config.PushLatest() {
+		return "", nil
+	}
+
+	taggedImage := b.config.GetImage()
+
+	// the tag follows the last colon, the registry host may have a port
+	i := strings.LastIndex(taggedImage, ":")
+	if i < 0 || strings.Contains(taggedImage[i:], "/") {
+		return "", fmt.Errorf("push: invalid image format")
+	}
 
-		return dockerPush(lastestImage)
+	if taggedImage[i+1:] == "latest" || b.config.ImmutableTags() {
+		return "", nil
 	}
 
-	return nil
+	return taggedImage[:i] + ":latest", nil
 }
 
 func dockerPush(image string) error {
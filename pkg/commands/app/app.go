@@ -27,7 +27,7 @@ func NewAppCommand(p *commands.Params) *cobra.Command {
 			appConfigJson, _ := json.MarshalIndent(appConfig, "", "  ")
 			fmt.Println(string(appConfigJson))
 
-			_, err = p.NewServingClient("default")
+			_, err = p.NewServingClient(commands.DefaultNamespace)
 			if err != nil {
 				return err
 			}
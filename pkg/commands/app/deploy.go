@@ -4,21 +4,21 @@ import (
 	"context"
 	"fmt"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ecr"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/fyve-labs/fyve-cli/pkg/builder"
 	"github.com/fyve-labs/fyve-cli/pkg/commands"
 	"github.com/fyve-labs/fyve-cli/pkg/config"
 	"github.com/fyve-labs/fyve-cli/pkg/deployer"
+	"github.com/fyve-labs/fyve-cli/pkg/docker"
+	"github.com/fyve-labs/fyve-cli/pkg/docker/images"
+	"github.com/fyve-labs/fyve-cli/pkg/registry"
 	"github.com/fyve-labs/fyve-cli/pkg/secrets"
+	"github.com/fyve-labs/fyve-cli/pkg/security"
 	"github.com/fyve-labs/fyve-cli/pkg/service"
 	"github.com/spf13/cobra"
 	"os"
-)
-
-const (
-	// DefaultDockerHost is the default Docker host to connect to
-	DefaultDockerHost = "tcp://socket-proxy:2375"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 var deploy_example = `
@@ -32,13 +32,26 @@ var deploy_example = `
   fyve deploy --scale-down-delay 10m
 
   # Deploy to a remote Docker host
-  fyve deploy --docker`
+  fyve deploy --docker
+
+  # Deploy staging next to prod, on <app>-staging.<domain>
+  fyve deploy --docker --env staging
+
+  # Also move :latest to the built image
+  fyve deploy --push-latest
+
+  # Deploy a third-party image pinned to the digest its tag points to now
+  fyve deploy --name whoami --image ghcr.io/traefik/whoami:latest --pin-digest`
 
 // NewDeployCmd returns the deploy command
 func NewDeployCmd(p *commands.Params) *cobra.Command {
 	var (
 		deployDocker bool
 		dockerHost   string
+		dockerTLS    docker.ClientTLS
+		pinDigest    bool
+		pushLatest   bool
+		environment  string
 	)
 
 	cmd := &cobra.Command{
@@ -50,7 +63,6 @@ func NewDeployCmd(p *commands.Params) *cobra.Command {
 			BindAppFlags(cmd.Flags())
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			environment := "prod"
 			projectDir, _ := os.Getwd()
 
 			// LoadAppConfig configuration
@@ -59,36 +71,92 @@ func NewDeployCmd(p *commands.Params) *cobra.Command {
 				return err
 			}
 
-			ctx := context.Background()
+			// Check for cosign before images are built and pushed unsigned
+			if appConfig.Security.Signing.Key != "" || appConfig.Deploy.VerifySignature != nil {
+				if err := security.RequireCosign(); err != nil {
+					return err
+				}
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+
 			awsConfig, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(appConfig.Region))
 			if err != nil {
 				return fmt.Errorf("AWS credentials: %w", err)
 			}
 
-			ecrClient := ecr.NewFromConfig(awsConfig)
-			ssmClient := ssm.NewFromConfig(awsConfig)
 			buildConfig := appConfig.BuildConfig()
+			buildConfig.SetPushLatest(pushLatest)
+
+			reg, err := registry.New(appConfig.Registry, awsConfig)
+			if err != nil {
+				return err
+			}
 
-			// Create SSM Manager Client
-			secretManager, err := secrets.NewSSMManager(ssmClient)
+			// Resolve secret references with the backends of the secrets block
+			secretManager, err := secrets.NewResolver(appConfig.Secrets, awsConfig)
 			if err != nil {
 				return fmt.Errorf("failed to initialize secrets manager: %w", err)
 			}
 
 			// Process environment variables and resolve any secret references
-			resolvedEnv, err := secretManager.ProcessSecretRefs(appConfig.Env, environment)
+			resolvedEnv, err := secretManager.ProcessSecretRefs(ctx, appConfig.Env, environment)
 			if err != nil {
 				return fmt.Errorf("failed to process secrets: %w", err)
 			}
 
-			if !appConfig.SkipBuild() {
-				err = buildConfig.EnsureECRRepositoryExists(ctx, ecrClient)
+			// Record what the secrets were resolved from, fyve secrets sync redeploys when their values change
+			if refs := secretManager.References(appConfig.Env); len(refs) > 0 {
+				values := make(map[string]string, len(refs))
+				for key := range refs {
+					values[key] = resolvedEnv[key]
+				}
+				appConfig.SecretRefs = refs
+				appConfig.SecretsSource = config.SecretsSource{Environment: environment, Region: appConfig.Region, Secrets: appConfig.Secrets}
+				appConfig.SecretsHash = secrets.Hash(values)
+			}
+
+			if len(appConfig.Services) > 0 && !deployDocker {
+				return fmt.Errorf("services are only supported when deploying to docker, use --docker")
+			}
+
+			// Kubernetes runs one service per app, other environments would replace prod
+			if environment != "prod" && !deployDocker {
+				return fmt.Errorf("environments other than prod are only supported when deploying to docker, use --docker")
+			}
+
+			// Resolve secret references of the services
+			for name, svc := range appConfig.Services {
+				if svc.Env, err = secretManager.ProcessSecretRefs(ctx, svc.Env, environment); err != nil {
+					return fmt.Errorf("failed to process secrets of service %s: %w", name, err)
+				}
+				appConfig.Services[name] = svc
+			}
+
+			needsRegistry := !appConfig.SkipBuild() || appConfig.HasServiceBuilds()
+			if needsRegistry {
+				repositoryURI, err := reg.EnsureRepository(ctx, buildConfig.GetRepositoryName())
 				if err != nil {
 					return err
 				}
+				buildConfig.SetRepositoryURI(repositoryURI)
 
+				if buildConfig.ImmutableTags() && strings.HasSuffix(buildConfig.GetImage(), ":latest") {
+					return fmt.Errorf("the repository has immutable tags, set IMAGE_TAG or GITHUB_SHA to tag the image")
+				}
+
+				// Builds with attestations push while building
+				if err := reg.Login(ctx); err != nil {
+					return fmt.Errorf("registry login: %w", err)
+				}
+				defer reg.Logout()
+			}
+
+			var b *builder.NextJSBuilder
+			if !appConfig.SkipBuild() {
 				// Set up builder
-				b, err := builder.NewNextJSBuilder(projectDir, appConfig.App, environment, buildConfig)
+				b, err = builder.NewNextJSBuilder(projectDir, appConfig.App, environment, buildConfig)
 				if err != nil {
 					return fmt.Errorf("failed to initialize builder: %w", err)
 				}
@@ -97,29 +165,101 @@ func NewDeployCmd(p *commands.Params) *cobra.Command {
 				if err := b.Build(); err != nil {
 					return fmt.Errorf("build failed: %w", err)
 				}
+			}
 
-				err = buildConfig.ECRLogin(ctx, ecrClient)
-				if err != nil {
-					return fmt.Errorf("ECRLogin: %w", err)
+			// Build services next to the app, they are pushed to the app's repository tagged <tag>-<service>
+			for name, svc := range appConfig.Services {
+				if svc.Build == nil {
+					continue
 				}
-				defer buildConfig.ECRLogout()
 
-				// Push to ECR
-				if err := b.PushToECR(); err != nil {
-					return fmt.Errorf("failed to push to ECR: %w", err)
+				svc.Image = buildConfig.GetServiceImage(name)
+				if err := builder.BuildDockerfile(svc.Build.Context, svc.Build.Dockerfile, svc.Image, buildConfig.Attestations()); err != nil {
+					return fmt.Errorf("build of service %s failed: %w", name, err)
+				}
+				appConfig.Services[name] = svc
+			}
+
+			// Pushed images are deployed by digest, so that moving a tag later does not change what runs
+			var pushed []string
+			if b != nil {
+				if err := b.Push(); err != nil {
+					return fmt.Errorf("failed to push to %s: %w", reg.Name(), err)
 				}
 
 				appConfig.Image = buildConfig.GetImage()
+				pinned, err := reg.PinImage(ctx, appConfig.Image)
+				if err != nil {
+					return err
+				}
+				appConfig.PinImage(pinned)
+				pushed = append(pushed, pinned)
+			} else if pinDigest {
+				pinned, err := images.PinImageDigest(ctx, appConfig.Image)
+				if err != nil {
+					return err
+				}
+				appConfig.PinImage(pinned)
+			}
+
+			for name, svc := range appConfig.Services {
+				var pinned string
+				if svc.Build != nil {
+					if !buildConfig.Attestations() {
+						if err := builder.Push(svc.Image); err != nil {
+							return fmt.Errorf("failed to push service %s to %s: %w", name, reg.Name(), err)
+						}
+					}
+
+					if pinned, err = reg.PinImage(ctx, svc.Image); err != nil {
+						return err
+					}
+					pushed = append(pushed, pinned)
+				} else if pinDigest {
+					if pinned, err = images.PinImageDigest(ctx, svc.Image); err != nil {
+						return err
+					}
+				} else {
+					continue
+				}
+
+				svc.ImageTag = svc.Image
+				svc.Image = pinned
+				appConfig.Services[name] = svc
+			}
+
+			if appConfig.Security.Scan.Enabled && len(pushed) > 0 {
+				if err := scanImages(ctx, reg, appConfig.Security.Scan, pushed); err != nil {
+					return err
+				}
+			}
+
+			if key := appConfig.Security.Signing.Key; key != "" {
+				for _, image := range pushed {
+					if err := security.SignImage(ctx, image, key, appConfig.Region); err != nil {
+						return err
+					}
+				}
+			}
+
+			if policy := appConfig.Deploy.VerifySignature; policy != nil {
+				if err := verifySignatures(ctx, appConfig, policy.Keys); err != nil {
+					return err
+				}
+			}
+
+			if appConfig.ImageTag != "" {
+				fmt.Printf("Pinned %s to %s\n", appConfig.ImageTag, appConfig.Image)
 			}
 
 			// Deploy to a remote Docker host
 			if deployDocker {
-				d, err := deployer.NewDockerDeployer(appConfig.App, buildConfig, dockerHost, resolvedEnv)
+				d, err := deployer.NewDockerDeployer(appConfig, dockerHost, dockerTLS, resolvedEnv)
 				if err != nil {
 					return fmt.Errorf("failed to create deployer: %w", err)
 				}
 
-				if err := d.Deploy(environment, appConfig.Port); err != nil {
+				if err := d.Deploy(ctx, environment); err != nil {
 					return fmt.Errorf("deployment failed: %w", err)
 				}
 
@@ -128,7 +268,7 @@ func NewDeployCmd(p *commands.Params) *cobra.Command {
 			}
 
 			// Deploy to Kubernetes
-			namespace := "default"
+			namespace := commands.DefaultNamespace
 			client, err := p.NewServingClient(namespace)
 			if err != nil {
 				return err
@@ -139,8 +279,88 @@ func NewDeployCmd(p *commands.Params) *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&deployDocker, "docker", false, "Deploy to docker instead of Kubernetes")
-	cmd.Flags().StringVarP(&dockerHost, "docker-host", "d", DefaultDockerHost, "Remote Docker host URL to deploy to")
+	cmd.Flags().StringVar(&environment, "env", "prod", "Environment to deploy to, other environments than prod need --docker")
+	cmd.Flags().StringVarP(&dockerHost, "docker-host", "d", commands.DefaultDockerHost, "Remote Docker host URL to deploy to")
+	commands.AddDockerTLSFlags(cmd.Flags(), &dockerTLS)
+	cmd.Flags().BoolVar(&pinDigest, "pin-digest", false, "Resolve --image and service images to their current digest and deploy that")
+	cmd.Flags().BoolVar(&pushLatest, "push-latest", false, "Also tag the built image latest and push it, ignored for repositories with immutable tags")
 	SetAppFlags(cmd.Flags())
 
 	return cmd
 }
+
+// verifySignatures refuses to deploy the app and service images unless they are signed by one of keys.
+// Images are pinned to their digest first, so that the verified image is the one deployed.
+func verifySignatures(ctx context.Context, appConfig *config.AppConfig, keys []string) error {
+	if !strings.Contains(appConfig.Image, "@sha256:") {
+		pinned, err := images.PinImageDigest(ctx, appConfig.Image)
+		if err != nil {
+			return err
+		}
+		appConfig.PinImage(pinned)
+	}
+
+	if err := security.VerifyImageSignature(ctx, appConfig.Image, keys, appConfig.Region); err != nil {
+		return err
+	}
+
+	for name, svc := range appConfig.Services {
+		if !strings.Contains(svc.Image, "@sha256:") {
+			pinned, err := images.PinImageDigest(ctx, svc.Image)
+			if err != nil {
+				return err
+			}
+			svc.ImageTag = svc.Image
+			svc.Image = pinned
+			appConfig.Services[name] = svc
+		}
+
+		if err := security.VerifyImageSignature(ctx, svc.Image, keys, appConfig.Region); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// scanImages fails when the scan of a pushed image has findings at or above the configured
+// severity that are not allowlisted, printing the findings and adding them to the GitHub step summary
+func scanImages(ctx context.Context, reg registry.Registry, cfg config.ScanConfig, pushed []string) error {
+	scanner, ok := reg.(registry.Scanner)
+	if !ok {
+		return fmt.Errorf("the %s registry does not scan images", reg.Name())
+	}
+
+	allowlist, err := security.LoadAllowlist(cfg.Allowlist)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.ScanTimeout())
+	defer cancel()
+
+	var failed []string
+	for _, image := range pushed {
+		findings, err := scanner.ScanFindings(ctx, image)
+		if err != nil {
+			return err
+		}
+
+		result := security.EvaluateScan(image, findings, cfg.Severity, allowlist)
+		summary := result.Summary()
+		fmt.Println(summary)
+		if err := security.WriteStepSummary(summary); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+
+		if result.Failed() {
+			failed = append(failed, image)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("vulnerability scan failed for %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
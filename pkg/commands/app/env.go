@@ -0,0 +1,305 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/fyve-labs/fyve-cli/pkg/secrets"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// defaultSecretPattern matches the names of variables fyve env import stores as secrets
+const defaultSecretPattern = `(?i)(SECRET|TOKEN|PASSWORD|PASSWD|PRIVATE|CREDENTIAL|APIKEY|_KEY$|DATABASE_URL|DSN|WEBHOOK)`
+
+// publicEnvPrefix marks Next.js variables inlined into the browser bundle, they are never secret
+const publicEnvPrefix = "NEXT_PUBLIC_"
+
+// NewEnvCommand creates the command group moving the env of an app from and to dotenv files
+func NewEnvCommand() *cobra.Command {
+	var (
+		appName     string
+		environment string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Import and export the env of an app as dotenv files",
+		Example: `
+  # Import a .env file, secrets go to SSM Parameter Store and the rest to fyve.yaml
+  fyve env import .env.production
+
+  # Choose for each variable whether it is a secret
+  fyve env import .env.production --interactive
+
+  # Write the env of staging, secrets resolved, for local development
+  fyve env pull --env staging > .env.local`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if appName != "" {
+				viper.Set("app", appName)
+			}
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&appName, "name", "", "App name, defaults to the app of fyve.yaml")
+	cmd.PersistentFlags().StringVar(&environment, "env", "prod", "Environment of the secrets")
+
+	newContext := func(ctx context.Context) (*secretsContext, error) {
+		return loadSecretsContext(ctx, environment)
+	}
+
+	cmd.AddCommand(newEnvImportCommand(newContext))
+	cmd.AddCommand(newEnvPullCommand(newContext))
+
+	return cmd
+}
+
+func newEnvImportCommand(newContext func(context.Context) (*secretsContext, error)) *cobra.Command {
+	var (
+		secretPattern string
+		interactive   bool
+		dryRun        bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Import the variables of a dotenv file",
+		Long: `Import the variables of a dotenv file.
+
+Variables whose name matches --secrets are written to SSM Parameter Store under
+/<app>/<env>/<NAME> and referenced from the env of fyve.yaml, like fyve secrets set does.
+The other variables are added to the env of fyve.yaml as they are. NEXT_PUBLIC_ variables
+are inlined into the browser bundle by Next.js and are not stored as secrets unless chosen
+with --interactive.
+
+The env of fyve.yaml is shared by all environments, so importing for another --env than prod
+fails when any variable would be stored as a plain value.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pattern, err := regexp.Compile(secretPattern)
+			if err != nil {
+				return fmt.Errorf("invalid --secrets pattern: %w", err)
+			}
+
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+
+			vars, err := config.ParseDotenv(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			vars = lastAssignments(vars)
+
+			for _, v := range vars {
+				if _, err := secretName(v.Name); err != nil {
+					return err
+				}
+			}
+
+			isSecret := make(map[string]bool, len(vars))
+			var in *bufio.Reader
+			if interactive {
+				in = bufio.NewReader(cmd.InOrStdin())
+			}
+			for _, v := range vars {
+				// Parameter Store does not accept empty values
+				secret := v.Value != "" && !strings.HasPrefix(v.Name, publicEnvPrefix) && pattern.MatchString(v.Name)
+				if interactive && v.Value != "" {
+					if secret, err = askSecret(cmd, in, v.Name, secret); err != nil {
+						return err
+					}
+				}
+				isSecret[v.Name] = secret
+			}
+
+			s, err := newContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			// The env of fyve.yaml is shared by all environments, only prod may write plain values to it
+			if s.environment != "prod" {
+				var plain []string
+				for _, v := range vars {
+					if !isSecret[v.Name] {
+						plain = append(plain, v.Name)
+					}
+				}
+				if len(plain) > 0 {
+					return fmt.Errorf("the env of fyve.yaml is shared by all environments, cannot import plain values for %s: %s; store them as secrets with --secrets or --interactive, or import them for prod",
+						s.environment, strings.Join(plain, ", "))
+				}
+			}
+
+			if dryRun {
+				w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+				fmt.Fprintln(w, "NAME\tSTORED AS")
+				for _, v := range vars {
+					if isSecret[v.Name] {
+						fmt.Fprintf(w, "%s\tsecret %s\n", v.Name, s.path(v.Name))
+					} else {
+						fmt.Fprintf(w, "%s\tplain value in fyve.yaml\n", v.Name)
+					}
+				}
+				return w.Flush()
+			}
+
+			env := make([]config.EnvVar, 0, len(vars))
+			secretCount := 0
+			for _, v := range vars {
+				value := v.Value
+				if isSecret[v.Name] {
+					if _, err := s.store.PutSecret(cmd.Context(), s.path(v.Name), v.Value); err != nil {
+						return err
+					}
+					value = secrets.SecretRef(s.appConfig.App, v.Name)
+					secretCount++
+				}
+
+				if current, ok := s.appConfig.Env[v.Name]; ok && current != value {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Warning: replacing %s in fyve.yaml\n", v.Name)
+				}
+				env = append(env, config.EnvVar{Name: v.Name, Value: value})
+			}
+
+			if _, err := config.SetEnvs(config.GlobalConfig.ConfigFile(), env); err != nil {
+				return fmt.Errorf("update %s: %w", config.GlobalConfig.ConfigFile(), err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Imported %d secrets to %s and %d plain variables to %s\n",
+				secretCount, s.path(""), len(vars)-secretCount, config.GlobalConfig.ConfigFile())
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&secretPattern, "secrets", defaultSecretPattern, "Regular expression matching the names of the variables to store as secrets")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Ask for each variable whether it is a secret, the pattern gives the default answer")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show how the variables would be stored without importing them")
+
+	return cmd
+}
+
+func newEnvPullCommand(newContext func(context.Context) (*secretsContext, error)) *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "pull",
+		Short: "Print the env of an environment as a dotenv file, secrets resolved",
+		Long: `Print the env of an environment as a dotenv file, secrets resolved.
+
+The env of fyve.yaml is resolved as fyve deploy does, for local development. Pulling the
+prod environment asks for a confirmation, or requires --yes when stdin is not a terminal.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := newContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if s.environment == "prod" && !yes {
+				ok, err := confirm(cmd, fmt.Sprintf("Print the production secrets of %s?", s.appConfig.App))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("aborted")
+				}
+			}
+
+			resolver, err := secrets.NewResolver(s.appConfig.Secrets, s.awsConfig)
+			if err != nil {
+				return fmt.Errorf("failed to initialize secrets manager: %w", err)
+			}
+
+			env, err := resolver.ProcessSecretRefs(cmd.Context(), s.appConfig.Env, s.environment)
+			if err != nil {
+				return err
+			}
+
+			vars := make([]config.EnvVar, 0, len(env))
+			for name, value := range env {
+				vars = append(vars, config.EnvVar{Name: name, Value: value})
+			}
+			sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+
+			fmt.Fprintf(cmd.OutOrStdout(), "# %s %s, written by fyve env pull\n", s.appConfig.App, s.environment)
+			fmt.Fprint(cmd.OutOrStdout(), config.FormatDotenv(vars))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Pull the prod environment without asking for a confirmation")
+
+	return cmd
+}
+
+// lastAssignments returns vars with the last value of each name, in the order names first appear
+func lastAssignments(vars []config.EnvVar) []config.EnvVar {
+	index := make(map[string]int)
+	var result []config.EnvVar
+	for _, v := range vars {
+		if i, ok := index[v.Name]; ok {
+			result[i].Value = v.Value
+			continue
+		}
+
+		index[v.Name] = len(result)
+		result = append(result, v)
+	}
+
+	return result
+}
+
+// askSecret asks whether name is a secret, secret is the default answer
+func askSecret(cmd *cobra.Command, in *bufio.Reader, name string, secret bool) (bool, error) {
+	options := "S/p"
+	if !secret {
+		options = "s/P"
+	}
+
+	for {
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s: store as a [s]ecret or a [p]lain value? [%s] ", name, options)
+		answer, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || answer == "") {
+			return false, fmt.Errorf("read answer: %w", err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "":
+			return secret, nil
+		case "s", "secret":
+			return true, nil
+		case "p", "plain":
+			return false, nil
+		}
+	}
+}
+
+// confirm asks question on the terminal, it fails when stdin is not a terminal
+func confirm(cmd *cobra.Command, question string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("cannot ask for a confirmation, stdin is not a terminal: pass --yes")
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "%s [y/N] ", question)
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
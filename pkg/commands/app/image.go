@@ -0,0 +1,188 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/fyve-labs/fyve-cli/pkg/registry"
+	"github.com/fyve-labs/fyve-cli/pkg/security"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewImageCommand creates the command group working with the images fyve builds
+func NewImageCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "image",
+		Short: "Work with the images built by fyve deploy",
+	}
+
+	cmd.AddCommand(newImageInspectCommand())
+
+	return cmd
+}
+
+func newImageInspectCommand() *cobra.Command {
+	var (
+		tag        string
+		sbom       bool
+		provenance bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "inspect [app|image]",
+		Short: "Show the SBOM and provenance of an image",
+		Example: `
+  # Show the build provenance of the app in fyve.yaml, for the tag deploy would push
+  fyve image inspect
+
+  # Print the SPDX SBOM of a tag of an app
+  fyve image inspect whoami --tag sha-1a2b3c4 --sbom
+
+  # Print the SLSA provenance of an image
+  fyve image inspect 123456789012.dkr.ecr.us-east-1.amazonaws.com/fyve/fyve-whoami:latest --provenance`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			var image string
+			if len(args) == 1 && strings.ContainsAny(args[0], "/:@") {
+				image = args[0]
+			} else {
+				if len(args) == 1 {
+					viper.Set("app", args[0])
+				}
+
+				appImage, logout, err := appImageForInspect(ctx, tag)
+				if err != nil {
+					return err
+				}
+				defer logout()
+				image = appImage
+			}
+
+			attestations, err := security.InspectAttestations(ctx, image)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case sbom:
+				return printJSON(cmd, attestations.SBOM)
+			case provenance:
+				return printJSON(cmd, attestations.Provenance)
+			}
+
+			return printAttestations(cmd, attestations)
+		},
+	}
+
+	cmd.Flags().StringVar(&tag, "tag", "", "Image tag of the app, defaults to the tag fyve deploy pushes (IMAGE_TAG, sha-<GITHUB_SHA> or latest)")
+	cmd.Flags().BoolVar(&sbom, "sbom", false, "Print the SPDX SBOM")
+	cmd.Flags().BoolVar(&provenance, "provenance", false, "Print the SLSA provenance")
+	cmd.MarkFlagsMutuallyExclusive("sbom", "provenance")
+
+	return cmd
+}
+
+// appImageForInspect returns the image of the app in the registry of fyve.yaml and logs in to it,
+// the returned function logs out
+func appImageForInspect(ctx context.Context, tag string) (string, func(), error) {
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		return "", nil, err
+	}
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(appConfig.Region))
+	if err != nil {
+		return "", nil, fmt.Errorf("AWS credentials: %w", err)
+	}
+
+	reg, err := registry.New(appConfig.Registry, awsConfig)
+	if err != nil {
+		return "", nil, err
+	}
+
+	buildConfig := appConfig.BuildConfig()
+	repositoryURI, err := reg.RepositoryURI(ctx, buildConfig.GetRepositoryName())
+	if err != nil {
+		return "", nil, err
+	}
+	buildConfig.SetRepositoryURI(repositoryURI)
+
+	image := buildConfig.GetImage()
+	if tag != "" {
+		image = repositoryURI + ":" + tag
+	}
+
+	if err := reg.Login(ctx); err != nil {
+		return "", nil, fmt.Errorf("registry login: %w", err)
+	}
+
+	return image, reg.Logout, nil
+}
+
+func printAttestations(cmd *cobra.Command, a *security.Attestations) error {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Image:\t%s\n", a.Image)
+
+	if a.SBOM != nil {
+		fmt.Fprintf(w, "SBOM:\tSPDX, %d packages\n", a.SBOMPackages())
+	} else {
+		fmt.Fprintf(w, "SBOM:\tnone\n")
+	}
+
+	if a.Provenance == nil {
+		fmt.Fprintf(w, "Provenance:\tnone\n")
+		return w.Flush()
+	}
+
+	p, err := a.ParseProvenance()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Builder:\t%s\n", p.BuilderID)
+	fmt.Fprintf(w, "Source:\t%s\n", p.Source)
+	fmt.Fprintf(w, "Revision:\t%s\n", p.Revision)
+	fmt.Fprintf(w, "fyve version:\t%s\n", p.Args["label:dev.fyve.version"])
+	fmt.Fprintf(w, "Built:\t%s - %s\n", p.StartedOn, p.FinishedOn)
+
+	keys := make([]string, 0, len(p.Args))
+	for key := range p.Args {
+		if strings.HasPrefix(key, "build-arg:") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if len(keys) > 0 {
+		fmt.Fprintf(w, "Build args:\t\n")
+		for _, key := range keys {
+			fmt.Fprintf(w, "  %s\t%s\n", strings.TrimPrefix(key, "build-arg:"), p.Args[key])
+		}
+	}
+
+	return w.Flush()
+}
+
+func printJSON(cmd *cobra.Command, doc json.RawMessage) error {
+	if doc == nil {
+		return fmt.Errorf("the image has no such attestation")
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, doc, "", "  "); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), out.String())
+	return nil
+}
@@ -41,7 +41,7 @@ func NewPublishCommand(p *commands.Params) *cobra.Command {
 				return errors.New(fmt.Sprintf("domain '%s' must end with '%s'", domain, baseDomain))
 			}
 
-			namespace := "default"
+			namespace := commands.DefaultNamespace
 
 			// 1. Create DomainMapping
 			reference := &duckv1.KReference{
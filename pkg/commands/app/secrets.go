@@ -0,0 +1,607 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/fyve-labs/fyve-cli/pkg/commands"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/fyve-labs/fyve-cli/pkg/secrets"
+	"github.com/fyve-labs/fyve-cli/pkg/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// secretNamePattern matches environment variable names, as fyve.yaml env keys are upper case
+var secretNamePattern = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// secretsContext is what the secrets sub-commands work with, the parameters of the app in
+// environment live under /<app>/<environment>/
+type secretsContext struct {
+	appConfig   *config.AppConfig
+	awsConfig   aws.Config
+	environment string
+	store       *secrets.SSMManager
+}
+
+func loadSecretsContext(ctx context.Context, environment string) (*secretsContext, error) {
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(appConfig.Region))
+	if err != nil {
+		return nil, fmt.Errorf("AWS credentials: %w", err)
+	}
+
+	store, err := secrets.NewSSMManagerFromConfig(appConfig.Secrets, awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &secretsContext{appConfig: appConfig, awsConfig: awsConfig, environment: environment, store: store}, nil
+}
+
+func (s *secretsContext) path(name string) string {
+	return secrets.SecretPath(s.appConfig.App, s.environment, name)
+}
+
+// references returns the env keys of the app and its services by the parameter they refer to in environment
+func (s *secretsContext) references(environment string) map[string][]string {
+	refs := make(map[string][]string)
+	add := func(env map[string]string, prefix string) {
+		for key, val := range env {
+			if param, ok := secrets.SSMParameter(val, environment); ok {
+				refs[param] = append(refs[param], prefix+key)
+			}
+		}
+	}
+
+	add(s.appConfig.Env, "")
+	for name, svc := range s.appConfig.Services {
+		add(svc.Env, name+".")
+	}
+
+	return refs
+}
+
+// NewSecretsCommand creates the command group managing the SSM parameters referenced by fyve.yaml
+func NewSecretsCommand() *cobra.Command {
+	var (
+		appName     string
+		environment string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage the secrets of an app in SSM Parameter Store",
+		Long: `Manage the secrets of an app in SSM Parameter Store.
+
+Secrets are SecureString parameters named /<app>/<environment>/<NAME>. fyve secrets set adds
+NAME: secret:/<app>/{environment}/<NAME> to the env of fyve.yaml, which fyve deploy resolves
+to the parameter of the environment being deployed.`,
+		Example: `
+  # Set a secret from stdin, it is prompted for without echo in a terminal
+  fyve secrets set DATABASE_URL
+
+  # Set a staging secret from a file
+  fyve secrets set TLS_KEY --env staging --from-file key.pem
+
+  # Compare the secrets fyve.yaml references with the parameters of production
+  fyve secrets diff
+
+  # Compare the secrets of two environments
+  fyve secrets diff staging prod`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if appName != "" {
+				viper.Set("app", appName)
+			}
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&appName, "name", "", "App name, defaults to the app of fyve.yaml")
+
+	newContext := func(ctx context.Context) (*secretsContext, error) {
+		return loadSecretsContext(ctx, environment)
+	}
+
+	cmd.AddCommand(newSecretsSetCommand(newContext))
+	cmd.AddCommand(newSecretsGetCommand(newContext))
+	cmd.AddCommand(newSecretsListCommand(newContext))
+	cmd.AddCommand(newSecretsRmCommand(newContext))
+	cmd.AddCommand(newSecretsDiffCommand(newContext))
+
+	// sync, added next to these, resolves in the environment the apps were deployed to
+	for _, sub := range cmd.Commands() {
+		sub.Flags().StringVar(&environment, "env", "prod", "Environment of the secrets")
+	}
+
+	return cmd
+}
+
+func newSecretsSetCommand(newContext func(context.Context) (*secretsContext, error)) *cobra.Command {
+	var fromFile string
+
+	cmd := &cobra.Command{
+		Use:   "set NAME",
+		Short: "Set a secret and reference it in fyve.yaml",
+		Long: `Set a secret and reference it in fyve.yaml.
+
+The value is read from stdin, or from --from-file, so that it never lands in the shell history.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, err := secretName(args[0])
+			if err != nil {
+				return err
+			}
+
+			value, err := readSecretValue(cmd, name, fromFile)
+			if err != nil {
+				return err
+			}
+
+			s, err := newContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			path := s.path(name)
+			version, err := s.store.PutSecret(cmd.Context(), path, value)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Set %s (version %d)\n", path, version)
+
+			if param, ok := secrets.SSMParameter(s.appConfig.Env[name], s.environment); ok && param == path {
+				return nil
+			}
+
+			if current, ok := s.appConfig.Env[name]; ok {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: replacing %s: %s in fyve.yaml\n", name, current)
+			}
+
+			ref := secrets.SecretRef(s.appConfig.App, name)
+			if _, err := config.SetEnv(config.GlobalConfig.ConfigFile(), name, ref); err != nil {
+				return fmt.Errorf("update %s: %w", config.GlobalConfig.ConfigFile(), err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Added %s: %s to %s\n", name, ref, config.GlobalConfig.ConfigFile())
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&fromFile, "from-file", "", "Read the value from a file instead of stdin")
+
+	return cmd
+}
+
+func newSecretsGetCommand(newContext func(context.Context) (*secretsContext, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get NAME",
+		Short: "Print the value of a secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, err := secretName(args[0])
+			if err != nil {
+				return err
+			}
+
+			s, err := newContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			value, err := s.store.GetSecret(cmd.Context(), s.path(name))
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), value)
+			return nil
+		},
+	}
+}
+
+func newSecretsListCommand(newContext func(context.Context) (*secretsContext, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the secrets of an environment, without their values",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := newContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			prefix := s.path("")
+			params, err := s.store.ListSecrets(cmd.Context(), prefix, false, false)
+			if err != nil {
+				return err
+			}
+
+			if len(params) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "No secrets found under %s\n", prefix)
+				return nil
+			}
+
+			refs := s.references(s.environment)
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVERSION\tLAST MODIFIED\tUSED BY")
+			for _, param := range params {
+				usedBy := strings.Join(refs[param.Name], ", ")
+				if usedBy == "" {
+					usedBy = "-"
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", strings.TrimPrefix(param.Name, prefix), param.Version, param.LastModified.Local().Format("2006-01-02 15:04"), usedBy)
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+func newSecretsRmCommand(newContext func(context.Context) (*secretsContext, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm NAME",
+		Short: "Delete a secret",
+		Long: `Delete a secret of an environment.
+
+The reference in fyve.yaml is removed once no environment has the secret anymore.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, err := secretName(args[0])
+			if err != nil {
+				return err
+			}
+
+			s, err := newContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			path := s.path(name)
+			if err := s.store.DeleteSecret(cmd.Context(), path); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Deleted %s\n", path)
+
+			// keep the reference while other environments have the secret
+			params, err := s.store.ListSecrets(cmd.Context(), "/"+s.appConfig.App, true, false)
+			if err != nil {
+				return err
+			}
+			for _, param := range params {
+				if strings.HasSuffix(param.Name, "/"+name) && strings.Count(param.Name, "/") == 3 {
+					return nil
+				}
+			}
+
+			if s.appConfig.Env[name] != secrets.SecretRef(s.appConfig.App, name) {
+				return nil
+			}
+
+			if _, err := config.UnsetEnv(config.GlobalConfig.ConfigFile(), name); err != nil {
+				return fmt.Errorf("update %s: %w", config.GlobalConfig.ConfigFile(), err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed %s from %s\n", name, config.GlobalConfig.ConfigFile())
+
+			return nil
+		},
+	}
+}
+
+func newSecretsDiffCommand(newContext func(context.Context) (*secretsContext, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff [ENV ENV]",
+		Short: "Compare secrets with fyve.yaml or between environments",
+		Long: `Compare secrets with fyve.yaml or between environments.
+
+Without arguments, the parameters under /<app>/<env>/ are compared with the references of
+fyve.yaml: - marks a referenced parameter that does not exist, + a parameter fyve.yaml does not
+reference. With two environments, - marks the secrets only the first one has and + the secrets
+only the second one has. Values are never printed.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 && len(args) != 2 {
+				return fmt.Errorf("expected no environment or two, got %d", len(args))
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := newContext(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			var removed, added []string
+			if len(args) == 2 {
+				removed, added, err = diffEnvironments(cmd.Context(), s, args[0], args[1])
+			} else {
+				removed, added, err = diffConfig(cmd.Context(), s)
+			}
+			if err != nil {
+				return err
+			}
+
+			if len(removed) == 0 && len(added) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No differences.")
+				return nil
+			}
+
+			for _, line := range removed {
+				fmt.Fprintln(cmd.OutOrStdout(), "- "+line)
+			}
+			for _, line := range added {
+				fmt.Fprintln(cmd.OutOrStdout(), "+ "+line)
+			}
+
+			return nil
+		},
+	}
+}
+
+// diffConfig returns the parameters fyve.yaml references under the prefix of the environment
+// that do not exist, and the parameters under it fyve.yaml does not reference
+func diffConfig(ctx context.Context, s *secretsContext) ([]string, []string, error) {
+	prefix := s.path("")
+	params, err := s.store.ListSecrets(ctx, prefix, false, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refs := s.references(s.environment)
+	existing := make(map[string]bool)
+
+	var missing, unused []string
+	for _, param := range params {
+		existing[param.Name] = true
+		if len(refs[param.Name]) == 0 {
+			unused = append(unused, strings.TrimPrefix(param.Name, prefix))
+		}
+	}
+
+	for param, keys := range refs {
+		if strings.HasPrefix(param, prefix) && !existing[param] {
+			sort.Strings(keys)
+			missing = append(missing, fmt.Sprintf("%s (%s)", strings.TrimPrefix(param, prefix), strings.Join(keys, ", ")))
+		}
+	}
+	sort.Strings(missing)
+
+	return missing, unused, nil
+}
+
+// diffEnvironments returns the secret names only environment from has, and those only to has
+func diffEnvironments(ctx context.Context, s *secretsContext, from, to string) ([]string, []string, error) {
+	names := func(environment string) (map[string]bool, error) {
+		prefix := secrets.SecretPath(s.appConfig.App, environment, "")
+		params, err := s.store.ListSecrets(ctx, prefix, false, false)
+		if err != nil {
+			return nil, err
+		}
+
+		names := make(map[string]bool)
+		for _, param := range params {
+			names[strings.TrimPrefix(param.Name, prefix)] = true
+		}
+
+		return names, nil
+	}
+
+	fromNames, err := names(from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	toNames, err := names(to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var onlyFrom, onlyTo []string
+	for name := range fromNames {
+		if !toNames[name] {
+			onlyFrom = append(onlyFrom, name)
+		}
+	}
+	for name := range toNames {
+		if !fromNames[name] {
+			onlyTo = append(onlyTo, name)
+		}
+	}
+	sort.Strings(onlyFrom)
+	sort.Strings(onlyTo)
+
+	return onlyFrom, onlyTo, nil
+}
+
+func secretName(name string) (string, error) {
+	if !secretNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid secret name %q: use an upper case environment variable name, such as DATABASE_URL", name)
+	}
+
+	return name, nil
+}
+
+// readSecretValue reads the value of name from file, or from stdin, prompting without echo in a terminal
+func readSecretValue(cmd *cobra.Command, name, file string) (string, error) {
+	var value string
+	switch fd := int(os.Stdin.Fd()); {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		value = string(data)
+	case term.IsTerminal(fd):
+		fmt.Fprintf(cmd.ErrOrStderr(), "Value of %s: ", name)
+		data, err := term.ReadPassword(fd)
+		fmt.Fprintln(cmd.ErrOrStderr())
+		if err != nil {
+			return "", err
+		}
+		value = string(data)
+	default:
+		data, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return "", err
+		}
+		// drop the newline echo and here-strings end with
+		value = strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+	}
+
+	if value == "" {
+		return "", fmt.Errorf("empty value for %s", name)
+	}
+
+	return value, nil
+}
+
+// NewSecretsSyncCommand creates the command redeploying apps whose secrets changed since they were deployed
+func NewSecretsSyncCommand(p *commands.Params) *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "sync [app]",
+		Short: "Redeploy apps whose secrets changed since they were deployed",
+		Long: `Redeploy apps whose secrets changed since they were deployed.
+
+fyve deploy records on the revision of an app its secret references, the environment and the
+secret backends (regions, Vault address) they were resolved with, and a hash of their values.
+sync resolves the references again the same way and rolls a new revision, with the same image
+and the new values, for the apps whose hash differs. Without an app, every app deployed with
+secrets is checked. Apps are left untouched when nothing changed, so sync can run from a cron
+job; it exits with an error when an app could not be synced.
+
+Only apps deployed to Kubernetes are synced. Apps deployed with --docker are skipped, redeploy
+them with fyve deploy --docker.`,
+		Example: `
+  # Redeploy the apps whose secrets were rotated
+  fyve secrets sync
+
+  # Check an app without redeploying it
+  fyve secrets sync whoami --dry-run`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			out := cmd.OutOrStdout()
+
+			appName, _ := cmd.Flags().GetString("name")
+			if len(args) == 1 {
+				appName = args[0]
+			}
+
+			client, err := p.NewServingClient(commands.DefaultNamespace)
+			if err != nil {
+				return err
+			}
+
+			serviceList, err := client.ListServices(ctx)
+			if err != nil {
+				return err
+			}
+
+			// Apps deployed with the same backends share a resolver
+			resolvers := make(map[string]*secrets.Resolver)
+			resolver := func(source config.SecretsSource) (*secrets.Resolver, error) {
+				key, err := json.Marshal(source)
+				if err != nil {
+					return nil, err
+				}
+
+				if r, ok := resolvers[string(key)]; ok {
+					return r, nil
+				}
+
+				awsConfig, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(source.Region))
+				if err != nil {
+					return nil, fmt.Errorf("AWS credentials: %w", err)
+				}
+
+				r, err := secrets.NewResolver(source.Secrets, awsConfig)
+				if err != nil {
+					return nil, fmt.Errorf("failed to initialize secrets manager: %w", err)
+				}
+
+				resolvers[string(key)] = r
+				return r, nil
+			}
+
+			var (
+				errs  []error
+				found bool
+			)
+			for i := range serviceList.Items {
+				svc := &serviceList.Items[i]
+				if appName != "" && svc.Name != appName {
+					continue
+				}
+				found = true
+
+				deployed, err := service.DeployedSecrets(svc)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				if deployed == nil {
+					if appName != "" {
+						fmt.Fprintf(out, "%s: no secrets recorded, deploy it with fyve deploy first\n", svc.Name)
+					}
+					continue
+				}
+
+				r, err := resolver(deployed.Source)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", svc.Name, err))
+					continue
+				}
+
+				env, err := r.ProcessSecretRefs(ctx, deployed.Refs, deployed.Source.Environment)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", svc.Name, err))
+					continue
+				}
+
+				newHash := secrets.Hash(env)
+				switch {
+				case newHash == deployed.Hash:
+					fmt.Fprintf(out, "%s: secrets unchanged\n", svc.Name)
+				case dryRun:
+					fmt.Fprintf(out, "%s: secrets changed, a new revision would be rolled\n", svc.Name)
+				default:
+					fmt.Fprintf(out, "%s: secrets changed, rolling a new revision\n", svc.Name)
+					if err := service.UpdateSecrets(ctx, client, svc.Name, env, newHash, out); err != nil {
+						errs = append(errs, fmt.Errorf("%s: %w", svc.Name, err))
+					}
+				}
+			}
+
+			if appName != "" && !found {
+				return fmt.Errorf("app %s not found", appName)
+			}
+
+			if len(errs) > 0 {
+				return fmt.Errorf("failed to sync secrets: %w", errors.Join(errs...))
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report the apps whose secrets changed without redeploying them")
+
+	return cmd
+}
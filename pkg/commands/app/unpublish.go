@@ -26,7 +26,7 @@ func NewUnPublishCommand(p *commands.Params) *cobra.Command {
 				return err
 			}
 
-			namespace := "default"
+			namespace := commands.DefaultNamespace
 
 			// Get client for domainmappings
 			client, err := p.NewServingV1beta1Client(namespace)
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientauthv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+)
+
+// NewCredentialHelperCommand creates the kubectl exec credential plugin reading the token from the credential store
+func NewCredentialHelperCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "credential-helper",
+		Short:  "Print the stored token as a Kubernetes ExecCredential",
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authConfig, err := config.LoadAuthConfig()
+			if err != nil {
+				return fmt.Errorf("error loading auth config: %w. Run \"fyve login\" to fix this issue and try again", err)
+			}
+
+			token := authConfig.IDToken
+			if token == "" {
+				token = authConfig.AccessToken
+			}
+
+			if token == "" {
+				return errors.New("could not find token in auth config. Run \"fyve login\" to fix this issue and try again")
+			}
+
+			if !authConfig.Expiry.IsZero() && authConfig.Expiry.Before(time.Now()) {
+				return errors.New("token expired. Run \"fyve login\" to fix this issue and try again")
+			}
+
+			credential := clientauthv1.ExecCredential{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: clientauthv1.SchemeGroupVersion.String(),
+					Kind:       "ExecCredential",
+				},
+				Status: &clientauthv1.ExecCredentialStatus{
+					Token: token,
+				},
+			}
+
+			if !authConfig.Expiry.IsZero() {
+				credential.Status.ExpirationTimestamp = &metav1.Time{Time: authConfig.Expiry}
+			}
+
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(credential)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/fyve-labs/fyve-cli/pkg/docker"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// DefaultDockerHost is the socket-proxy endpoint of the Docker deploy target
+const DefaultDockerHost = "tcp://socket-proxy:2375"
+
+// AddDockerTLSFlags adds the flags to reach a Docker host, such as socket-proxy --listen, over mutual TLS
+func AddDockerTLSFlags(flags *flag.FlagSet, tlsOptions *docker.ClientTLS) {
+	flags.StringVar(&tlsOptions.CertFile, "tls-cert", "", "Client certificate for the Docker host")
+	flags.StringVar(&tlsOptions.KeyFile, "tls-key", "", "Client certificate key for the Docker host")
+	flags.StringVar(&tlsOptions.CAFile, "tls-ca", "", "CA certificate of the Docker host")
+}
+
+// NewDockerCommand creates the command group managing fyve containers on a Docker host
+func NewDockerCommand() *cobra.Command {
+	var (
+		dockerHost  string
+		environment string
+		tlsOptions  docker.ClientTLS
+	)
+
+	cmd := &cobra.Command{
+		Use:   "docker",
+		Short: "Manage applications deployed to a Docker host",
+		Example: `
+  # List fyve-managed containers
+  fyve docker ps
+
+  # Follow the logs of an app
+  fyve docker logs -f whoami
+
+  # Restart the staging container of an app
+  fyve docker restart whoami --env staging`,
+	}
+
+	cmd.PersistentFlags().StringVarP(&dockerHost, "docker-host", "d", DefaultDockerHost, "Remote Docker host URL")
+	cmd.PersistentFlags().StringVar(&environment, "env", "", "Environment of the app, required when the app is deployed to several")
+	AddDockerTLSFlags(cmd.PersistentFlags(), &tlsOptions)
+
+	newContainerService := func() (*docker.ContainerService, error) {
+		return docker.NewContainerService(dockerHost, tlsOptions)
+	}
+
+	cmd.AddCommand(newDockerPsCommand(newContainerService))
+	cmd.AddCommand(newDockerLogsCommand(newContainerService, &environment))
+	cmd.AddCommand(newDockerRestartCommand(newContainerService, &environment))
+	cmd.AddCommand(newDockerRmCommand(newContainerService, &environment))
+
+	return cmd
+}
+
+func newDockerPsCommand(newContainerService func() (*docker.ContainerService, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   "ps",
+		Short: "List fyve-managed containers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			containerService, err := newContainerService()
+			if err != nil {
+				return err
+			}
+
+			containers, err := containerService.List(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if len(containers) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No containers found.")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			defer w.Flush()
+
+			fmt.Fprintln(w, "NAME\tAPP\tENV\tIMAGE\tSTATUS")
+			for _, container := range containers {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+					docker.ContainerName(container),
+					container.Labels[docker.LabelApp],
+					container.Labels[docker.LabelEnvironment],
+					container.Image,
+					container.Status,
+				)
+			}
+
+			return nil
+		},
+	}
+}
+
+func newDockerLogsCommand(newContainerService func() (*docker.ContainerService, error), environment *string) *cobra.Command {
+	var (
+		follow bool
+		tail   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs <app>",
+		Short: "Print the logs of an app's container",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			containerService, err := newContainerService()
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+
+			container, err := containerService.Find(ctx, args[0], *environment)
+			if err != nil {
+				return err
+			}
+
+			return containerService.Logs(ctx, container.ID, follow, tail, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow log output")
+	cmd.Flags().StringVar(&tail, "tail", "all", "Number of lines to show from the end of the logs")
+
+	return cmd
+}
+
+func newDockerRestartCommand(newContainerService func() (*docker.ContainerService, error), environment *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restart <app>",
+		Short: "Restart an app's container",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runOnContainer(cmd.Context(), newContainerService, args[0], *environment, func(containerService *docker.ContainerService, id, name string) error {
+				if err := containerService.Restart(cmd.Context(), id); err != nil {
+					return err
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "Restarted %s\n", name)
+				return nil
+			})
+		},
+	}
+}
+
+func newDockerRmCommand(newContainerService func() (*docker.ContainerService, error), environment *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <app>",
+		Short: "Stop and remove an app's containers and network",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			containerService, err := newContainerService()
+			if err != nil {
+				return err
+			}
+
+			container, err := containerService.Find(cmd.Context(), args[0], *environment)
+			if err != nil {
+				return err
+			}
+
+			// Services deployed next to the app are removed with it, volumes are kept
+			appName := container.Labels[docker.LabelApp]
+			env := container.Labels[docker.LabelEnvironment]
+			removed, err := containerService.RemoveGroup(cmd.Context(), appName, env)
+			for _, name := range removed {
+				fmt.Fprintf(cmd.OutOrStdout(), "Removed %s\n", name)
+			}
+
+			return err
+		},
+	}
+}
+
+func runOnContainer(ctx context.Context, newContainerService func() (*docker.ContainerService, error), nameOrApp, environment string, f func(containerService *docker.ContainerService, id, name string) error) error {
+	containerService, err := newContainerService()
+	if err != nil {
+		return err
+	}
+
+	container, err := containerService.Find(ctx, nameOrApp, environment)
+	if err != nil {
+		return err
+	}
+
+	return f(containerService, container.ID, docker.ContainerName(*container))
+}
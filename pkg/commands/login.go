@@ -9,9 +9,12 @@ import (
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/fyve-labs/fyve-cli/pkg/auth"
 	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/fyve-labs/fyve-cli/pkg/credentials"
 	"github.com/pkg/browser"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"golang.org/x/oauth2"
 )
 
@@ -26,12 +29,31 @@ func NewLoginCommand() *cobra.Command {
 		oidcClientID           string
 		oidcClientSecret       string
 		oidcCrossTrustClientID string
+		ci                     bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "login",
 		Short: "Login to Fyve App Platform",
+		Example: `
+  # Login through the browser
+  fyve login
+
+  # Exchange the CI job's identity token for a Fyve token
+  fyve login --ci
+
+  # Force the provider and connector when auto-detection is not enough
+  fyve login --ci --ci-provider gitlab --connector-id gitlab-internal`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			_ = viper.BindPFlag("oidc.ci.provider", cmd.Flags().Lookup("ci-provider"))
+			_ = viper.BindPFlag("oidc.ci.connector_id", cmd.Flags().Lookup("connector-id"))
+			_ = viper.BindPFlag("oidc.ci.audience", cmd.Flags().Lookup("audience"))
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if ci {
+				return loginCI(cmd)
+			}
+
 			oidcProvider, err := oidc.NewProvider(cmd.Context(), oidcIssuerURL)
 			if err != nil {
 				return err
@@ -146,6 +168,12 @@ func NewLoginCommand() *cobra.Command {
 			}
 
 			fmt.Fprintf(cmd.OutOrStdout(), "Logged in\n")
+
+			// kubectl runs the credential helper without a terminal to prompt for the passphrase on
+			if store, err := config.CredentialStore(); err == nil && store.Name() == credentials.StoreEncryptedFile && os.Getenv(credentials.PassphraseEnv) == "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: credentials are encrypted with a passphrase that kube commands cannot prompt for, export %s to use them\n", credentials.PassphraseEnv)
+			}
+
 			return nil
 		},
 	}
@@ -154,10 +182,36 @@ func NewLoginCommand() *cobra.Command {
 	cmd.Flags().StringVar(&oidcClientID, "oidc-client-id", "fyve-cli", "OIDC client ID")
 	cmd.Flags().StringVar(&oidcClientSecret, "oidc-client-secret", "", "OIDC client secret")
 	cmd.Flags().StringVar(&oidcCrossTrustClientID, "oidc-cross-trust-client-id", "fyve-k3s", "Trusted Client ID to be included in \"aud\" claim. More info at https://dexidp.io/docs/configuration/custom-scopes-claims-clients/#cross-client-trust-and-authorized-party")
+	cmd.Flags().BoolVar(&ci, "ci", false, "Exchange the CI job's OIDC identity token instead of opening a browser")
+	cmd.Flags().String("ci-provider", "", "CI provider to use instead of auto-detection (github-actions, gitlab, buildkite, circleci)")
+	cmd.Flags().String("connector-id", "", "Dex connector used for the token exchange (default: the CI provider's name)")
+	cmd.Flags().String("audience", "api://FyveTokenExchange", "Audience requested for the CI identity token")
 
 	return cmd
 }
 
+// loginCI runs the CI token exchange explicitly and reports its result
+func loginCI(cmd *cobra.Command) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), time.Second*60)
+	defer cancel()
+
+	result, err := auth.ExchangeCIToken(ctx)
+	if err != nil {
+		return fmt.Errorf("exchange CI credential: %w", err)
+	}
+
+	if result == nil {
+		return errors.New("no supported CI environment detected (GitHub Actions, GitLab CI, Buildkite, CircleCI)")
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Logged in with %s identity through connector %s\n", result.Provider, result.ConnectorID)
+	if !result.Expiry.IsZero() {
+		fmt.Fprintf(cmd.OutOrStdout(), "Token expires at %s\n", result.Expiry.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
 const htmlTemplate = `
 <!DOCTYPE html>
 <html lang="en">
@@ -1,26 +1,100 @@
 package commands
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fyve-labs/fyve-cli/pkg/auth"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/fyve-labs/fyve-cli/pkg/credentials"
 	"github.com/spf13/cobra"
-	"os"
-	"path/filepath"
 )
 
 // NewLogoutCommand creates a new logout command
 func NewLogoutCommand() *cobra.Command {
+	var allProfiles bool
+
 	cmd := &cobra.Command{
 		Use:   "logout",
-		Short: "Clears the local auth config and logs out of the Fyve App Platform.",
+		Short: "Revokes the stored tokens and removes them from the credential store.",
+		Example: `
+  # Logout of the active profile
+  fyve logout
+
+  # Logout of every profile
+  fyve logout --all-profiles`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			homeDir, err := os.UserHomeDir()
+			profiles := []string{config.Profile()}
+			if allProfiles {
+				var err error
+				if profiles, err = config.Profiles(); err != nil {
+					return err
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), time.Second*30)
+			defer cancel()
+
+			endpoint, err := auth.RevocationEndpoint(ctx)
 			if err != nil {
-				return err
+				fmt.Fprintf(cmd.OutOrStderr(), "Warning: failed to discover revocation endpoint, tokens will only be removed locally: %v\n", err)
+			} else if endpoint == "" {
+				fmt.Fprintln(cmd.OutOrStdout(), "Issuer does not advertise a revocation endpoint, tokens will only be removed locally")
 			}
 
-			fyveDir := filepath.Join(homeDir, ".fyve")
-			return os.RemoveAll(fyveDir)
+			var failed []string
+			loggedOut := 0
+			for _, profile := range profiles {
+				authConfig, err := config.LoadProfileAuthConfig(profile)
+				if errors.Is(err, credentials.ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					fmt.Fprintf(cmd.OutOrStderr(), "Warning: failed to load credentials of profile %s: %v\n", profile, err)
+				}
+
+				if authConfig != nil && endpoint != "" {
+					revoked, err := auth.RevokeTokens(ctx, endpoint, authConfig)
+					if len(revoked) > 0 {
+						fmt.Fprintf(cmd.OutOrStdout(), "Revoked %s of profile %s\n", strings.Join(revoked, ", "), profile)
+					}
+					if err != nil {
+						fmt.Fprintf(cmd.OutOrStderr(), "Warning: failed to revoke tokens of profile %s: %v\n", profile, err)
+					}
+				}
+
+				if err := config.DeleteAuthConfig(profile); err != nil && !errors.Is(err, credentials.ErrNotFound) {
+					failed = append(failed, profile)
+					fmt.Fprintf(cmd.OutOrStderr(), "Warning: failed to remove credentials of profile %s: %v\n", profile, err)
+					continue
+				}
+
+				loggedOut++
+				fmt.Fprintf(cmd.OutOrStdout(), "Removed credentials of profile %s\n", profile)
+
+				if removed, err := config.RemoveKubeconfigTokens(profile); err != nil {
+					fmt.Fprintf(cmd.OutOrStderr(), "Warning: failed to remove tokens from kubeconfig of profile %s: %v\n", profile, err)
+				} else if removed {
+					fmt.Fprintf(cmd.OutOrStdout(), "Removed tokens from kubeconfig of profile %s\n", profile)
+				}
+			}
+
+			if len(failed) > 0 {
+				return fmt.Errorf("failed to logout of some profiles: %v", failed)
+			}
+
+			if loggedOut == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "Not logged in")
+			}
+
+			return nil
 		},
 	}
 
+	cmd.Flags().BoolVar(&allProfiles, "all-profiles", false, "Logout of every stored profile")
+
 	return cmd
 }
@@ -15,6 +15,9 @@ import (
 	"os"
 )
 
+// DefaultNamespace is the namespace fyve deploys apps to and manages them in
+const DefaultNamespace = "default"
+
 type Params struct {
 	k8s.Params
 
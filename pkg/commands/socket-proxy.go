@@ -2,14 +2,15 @@ package commands
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"github.com/fyve-labs/fyve-cli/pkg/socketproxy"
 	"github.com/spf13/cobra"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -18,22 +19,33 @@ import (
 	"time"
 )
 
-var (
-	socketProxy *httputil.ReverseProxy
-)
-
 func NewSocketProxyCmd() *cobra.Command {
 	var (
 		hostname    string
 		stateDir    string
 		loginServer string
 		socketPath  string
+		policyFile  string
+		readOnly    bool
+		fullAccess  bool
+		auditLog    string
+		listenAddr  string
+		tlsCert     string
+		tlsKey      string
+		tlsClientCA string
+		metricsAddr string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "socket-proxy",
 		Short: "Docker socket proxy server",
-		Args:  cobra.MaximumNArgs(1),
+		Long: `Expose the Docker socket on the tailnet, or on a TCP address with --listen.
+
+Callers are identified through Tailscale, or by their client certificate when listening on TCP
+with mutual TLS, and every call is checked against an allowlist policy.
+One of --policy, --read-only or --full-access is required. Mutating and denied calls are
+written as JSON to the audit log.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if hostname == "" {
 				if val := os.Getenv("TS_HOSTNAME"); val != "" {
@@ -59,34 +71,85 @@ func NewSocketProxyCmd() *cobra.Command {
 				}
 			}
 
-			s := &tsnet.Server{
-				Dir:        filepath.Join(stateDir, "tsnet"),
-				Hostname:   hostname,
-				ControlURL: loginServer,
+			policy, err := loadSocketProxyPolicy(policyFile, readOnly, fullAccess)
+			if err != nil {
+				return err
 			}
 
-			// Wait until tailscale is fully up, so that CertDomains has data.
-			if _, err := s.Up(context.Background()); err != nil {
-				return fmt.Errorf("tailscale did not come up: %w", err)
+			audit, closeAudit, err := openAuditLog(auditLog)
+			if err != nil {
+				return err
 			}
+			defer closeAudit()
+
+			var (
+				l             net.Listener
+				identify      socketproxy.Identifier
+				address       string
+				checks        = []socketproxy.HealthCheck{socketproxy.SocketHealthCheck(socketPath)}
+				tailnetMetric func(w io.Writer)
+			)
+
+			if listenAddr != "" {
+				// Hosts outside the tailnet authenticate with a client certificate
+				tlsConfig, err := socketproxy.ServerTLSConfig(tlsCert, tlsKey, tlsClientCA)
+				if err != nil {
+					return err
+				}
 
-			socketURLDummy, _ := url.Parse("http://localhost") // dummy URL - we use the unix socket
-			socketProxy = httputil.NewSingleHostReverseProxy(socketURLDummy)
-			socketProxy.Transport = &http.Transport{
-				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-					return net.Dial("unix", socketPath)
-				},
-			}
+				l, err = tls.Listen("tcp", listenAddr, tlsConfig)
+				if err != nil {
+					return fmt.Errorf("error listening on %s: %w", listenAddr, err)
+				}
+				identify = socketproxy.CertificateIdentifier()
+				address = l.Addr().String()
+			} else {
+				s := &tsnet.Server{
+					Dir:        filepath.Join(stateDir, "tsnet"),
+					Hostname:   hostname,
+					ControlURL: loginServer,
+				}
 
-			l, err := s.Listen("tcp", ":2375")
-			if err != nil {
-				slog.Error("error listening on address", "error", err)
-				os.Exit(2)
+				// Wait until tailscale is fully up, so that CertDomains has data.
+				if _, err := s.Up(context.Background()); err != nil {
+					return fmt.Errorf("tailscale did not come up: %w", err)
+				}
+
+				lc, err := s.LocalClient()
+				if err != nil {
+					return fmt.Errorf("failed to get tailscale local client: %w", err)
+				}
+
+				l, err = s.Listen("tcp", ":2375")
+				if err != nil {
+					slog.Error("error listening on address", "error", err)
+					os.Exit(2)
+				}
+				identify = socketproxy.TailnetIdentifier(lc)
+				address = s.Hostname + ":2375"
+				checks = append(checks, socketproxy.TailnetHealthCheck(lc))
+				tailnetMetric = socketproxy.TailnetMetrics(lc)
 			}
+
+			metrics := socketproxy.NewMetrics()
 			srv := &http.Server{
-				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					socketProxy.ServeHTTP(w, r)
-				}),
+				Handler: socketproxy.NewProxy(socketPath, policy, identify, audit, metrics),
+			}
+
+			// Health and metrics are served on a separate local port, outside of the access policy
+			var metricsSrv *http.Server
+			if metricsAddr != "" {
+				mux := http.NewServeMux()
+				mux.Handle("/healthz", socketproxy.HealthHandler(checks...))
+				mux.Handle("/metrics", socketproxy.MetricsHandler(metrics, tailnetMetric))
+				metricsSrv = &http.Server{Addr: metricsAddr, Handler: mux}
+
+				go func() {
+					slog.Info(fmt.Sprintf("Serving health and metrics on %s...", metricsAddr))
+					if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+						slog.Error("metrics server problem", "error", err)
+					}
+				}()
 			}
 
 			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -98,10 +161,13 @@ func NewSocketProxyCmd() *cobra.Command {
 				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 				defer cancel()
 				_ = srv.Shutdown(ctx)
+				if metricsSrv != nil {
+					_ = metricsSrv.Shutdown(ctx)
+				}
 				slog.Info("Stopped")
 			}()
 
-			slog.Info(fmt.Sprintf("Starting socket-proxy: %s:2375...", s.Hostname))
+			slog.Info(fmt.Sprintf("Starting socket-proxy: %s...", address))
 			if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				slog.Error("proxy server problem", "error", err)
 				os.Exit(2)
@@ -112,9 +178,54 @@ func NewSocketProxyCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&hostname, "hostname", "", "", "Tailscale hostname to use")
-	cmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "Tailscale coordination server URL")
-	cmd.Flags().StringVarP(&loginServer, "login-server", "", "", "Server state directory")
+	cmd.Flags().StringVarP(&stateDir, "state-dir", "s", "", "Server state directory")
+	cmd.Flags().StringVarP(&loginServer, "login-server", "", "", "Tailscale coordination server URL")
 	cmd.Flags().StringVarP(&socketPath, "socket-path", "", "", "Docker socket path")
+	cmd.Flags().StringVar(&policyFile, "policy", "", "Access policy file (YAML or JSON)")
+	cmd.Flags().BoolVar(&readOnly, "read-only", false, "Only allow inspecting containers, images, networks and volumes")
+	cmd.Flags().StringVar(&auditLog, "audit-log", "-", "Audit log file, - for stdout")
+	cmd.Flags().StringVar(&listenAddr, "listen", "", "Listen on a TCP address with mutual TLS instead of the tailnet, e.g. :2376")
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "Server certificate for --listen")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "Server certificate key for --listen")
+	cmd.Flags().StringVar(&tlsClientCA, "tls-client-ca", "", "CA that signs the accepted client certificates for --listen")
+	cmd.Flags().StringVar(&metricsAddr, "metrics-listen", "127.0.0.1:9102", "Address serving /healthz and /metrics, empty to disable")
+	cmd.Flags().BoolVar(&fullAccess, "full-access", false, "Allow every caller full access to the Docker socket")
+	cmd.MarkFlagsMutuallyExclusive("policy", "read-only", "full-access")
+	cmd.MarkFlagsRequiredTogether("listen", "tls-cert", "tls-key", "tls-client-ca")
 
 	return cmd
 }
+
+func loadSocketProxyPolicy(policyFile string, readOnly, fullAccess bool) (*socketproxy.Policy, error) {
+	if policyFile == "" {
+		policyFile = os.Getenv("SOCKET_PROXY_POLICY")
+	}
+
+	switch {
+	case policyFile != "":
+		return socketproxy.LoadPolicy(policyFile)
+	case readOnly:
+		return socketproxy.PresetPolicy(socketproxy.PresetReadOnly)
+	case fullAccess:
+		slog.Warn("full access configured, every caller has full access to the Docker socket")
+		return socketproxy.PresetPolicy(socketproxy.PresetFull)
+	}
+
+	return nil, fmt.Errorf("no access policy configured: pass --policy (or SOCKET_PROXY_POLICY), --read-only, or --full-access to give every caller full access")
+}
+
+func openAuditLog(path string) (*slog.Logger, func(), error) {
+	var w io.Writer = os.Stdout
+	closeFunc := func() {}
+
+	if path != "" && path != "-" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		w = f
+		closeFunc = func() { _ = f.Close() }
+	}
+
+	return slog.New(slog.NewJSONHandler(w, nil)).With("log", "audit"), closeFunc, nil
+}
@@ -3,15 +3,23 @@ package commands
 import (
 	"context"
 	"fmt"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
 	"github.com/fyve-labs/fyve-cli/pkg/docker"
+	"github.com/fyve-labs/fyve-cli/pkg/docker/images"
+	"github.com/fyve-labs/fyve-cli/pkg/security"
 	"github.com/spf13/cobra"
+	"strings"
 	"time"
 )
 
 func NewUpdateCmd() *cobra.Command {
 	var (
-		imageTag   string
-		dockerHost string
+		imageTag      string
+		dockerHost    string
+		healthTimeout time.Duration
+		healthURL     string
+		noRollback    bool
+		tlsOptions    docker.ClientTLS
 	)
 
 	cmd := &cobra.Command{
@@ -36,12 +44,42 @@ func NewUpdateCmd() *cobra.Command {
 			defer cancel()
 
 			containerName := appName
-			containerService, err := docker.NewContainerService(dockerHost)
+			containerService, err := docker.NewContainerService(dockerHost, tlsOptions)
 			if err != nil {
 				return err
 			}
 
-			_, err = containerService.ReCreate(ctx, containerName, true, imageTag)
+			// Services deployed next to the app are recreated with it as one unit
+			targets, err := containerService.AppTargets(ctx, containerName, imageTag)
+			if err != nil {
+				return err
+			}
+
+			deployConfig, region, err := config.LoadDeployConfig()
+			if err != nil {
+				return err
+			}
+
+			// Images are pinned to their digest first, so that the verified image is the one deployed
+			if policy := deployConfig.VerifySignature; policy != nil {
+				for i := range targets {
+					if !strings.Contains(targets[i].Image, "@sha256:") {
+						if targets[i].Image, err = images.PinImageDigest(ctx, targets[i].Image); err != nil {
+							return err
+						}
+					}
+
+					if err := security.VerifyImageSignature(ctx, targets[i].Image, policy.Keys, region); err != nil {
+						return err
+					}
+				}
+			}
+
+			check := docker.HealthCheck{
+				Timeout: healthTimeout,
+				URL:     healthURL,
+			}
+			_, err = containerService.ReCreateGroup(ctx, targets, true, check, noRollback)
 
 			return err
 		},
@@ -49,7 +87,11 @@ func NewUpdateCmd() *cobra.Command {
 
 	// Add flags
 	cmd.Flags().StringVarP(&imageTag, "tag", "t", "", "New image tag")
-	cmd.Flags().StringVarP(&dockerHost, "docker-host", "d", "tcp://10.100.26.239:2375", "Remote Docker host URL")
+	cmd.Flags().StringVarP(&dockerHost, "docker-host", "d", DefaultDockerHost, "Remote Docker host URL")
+	cmd.Flags().DurationVar(&healthTimeout, "health-timeout", time.Minute, "Time to wait for the new container to become healthy, 0 disables the health check")
+	cmd.Flags().StringVar(&healthURL, "health-url", "", "URL probed over HTTP once the app container is healthy, services are not probed")
+	cmd.Flags().BoolVar(&noRollback, "no-rollback", false, "Keep the new container when it is not healthy instead of restoring the old one, which is kept stopped as <name>-old")
+	AddDockerTLSFlags(cmd.Flags(), &tlsOptions)
 
 	return cmd
 }
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fyve-labs/fyve-cli/pkg/auth"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+type whoamiOutput struct {
+	*auth.Identity
+	Kubeconfig string `json:"kubeconfig"`
+	Context    string `json:"context"`
+	Namespace  string `json:"namespace"`
+}
+
+// NewWhoamiCommand creates a new whoami command
+func NewWhoamiCommand(p *Params) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "whoami",
+		Short: "Show the logged in identity and the cluster context in use",
+		Example: `
+  # Show who you are logged in as
+  fyve whoami
+
+  # Machine-readable output
+  fyve whoami -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "" && output != "json" {
+				return fmt.Errorf("unsupported output format %q, only json is supported", output)
+			}
+
+			identity, err := auth.StoredIdentity(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			result := whoamiOutput{
+				Identity:   identity,
+				Kubeconfig: p.Params.KubeCfgPath,
+				Namespace:  DefaultNamespace,
+			}
+
+			if result.Kubeconfig == "" {
+				if result.Kubeconfig, err = config.KubeconfigPath(); err != nil {
+					return err
+				}
+			}
+
+			// The kubeconfig is created on the first cluster command, so it may not exist yet
+			if kubeconfig, err := clientcmd.LoadFromFile(result.Kubeconfig); err == nil {
+				result.Context = kubeconfig.CurrentContext
+				if p.Params.KubeContext != "" {
+					result.Context = p.Params.KubeContext
+				}
+			}
+
+			if output == "json" {
+				data, err := json.MarshalIndent(result, "", "  ")
+				if err != nil {
+					return err
+				}
+
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+				return nil
+			}
+
+			expiry := fmt.Sprintf("%s (%s remaining)", identity.Expiry.Format(time.RFC3339), identity.Remaining)
+			if identity.Expired {
+				expiry = fmt.Sprintf("%s (expired, run \"fyve login\")", identity.Expiry.Format(time.RFC3339))
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			defer w.Flush()
+
+			fmt.Fprintf(w, "Subject:\t%s\n", identity.Subject)
+			fmt.Fprintf(w, "Email:\t%s\n", valueOrNone(identity.Email))
+			fmt.Fprintf(w, "Groups:\t%s\n", valueOrNone(strings.Join(identity.Groups, ", ")))
+			fmt.Fprintf(w, "Audience:\t%s\n", strings.Join(identity.Audience, ", "))
+			fmt.Fprintf(w, "Issuer:\t%s\n", identity.Issuer)
+			fmt.Fprintf(w, "Expiry:\t%s\n", expiry)
+			fmt.Fprintf(w, "Kubeconfig:\t%s\n", result.Kubeconfig)
+			fmt.Fprintf(w, "Context:\t%s\n", valueOrNone(result.Context))
+			fmt.Fprintf(w, "Namespace:\t%s\n", result.Namespace)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format. One of: json")
+
+	return cmd
+}
+
+func valueOrNone(val string) string {
+	if val == "" {
+		return "<none>"
+	}
+
+	return val
+}
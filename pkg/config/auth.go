@@ -2,9 +2,14 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/fyve-labs/fyve-cli/pkg/credentials"
+	"github.com/spf13/viper"
 )
 
 // AuthConfig represents the authentication configuration
@@ -15,48 +20,66 @@ type AuthConfig struct {
 	Expiry       time.Time `json:"expiry"`
 }
 
-// SaveAuthConfig saves the authentication configuration to ~/.fyve/config.json
-func SaveAuthConfig(authConfig AuthConfig) error {
-	homeDir, err := os.UserHomeDir()
+// CredentialStore returns the store configured through credentials.store (FYVE_CREDENTIALS_STORE)
+func CredentialStore() (credentials.Store, error) {
+	return credentials.NewStore(viper.GetString("credentials.store"))
+}
+
+// Profile returns the name of the active credentials profile (FYVE_PROFILE)
+func Profile() string {
+	if profile := viper.GetString("profile"); profile != "" {
+		return profile
+	}
+
+	return "default"
+}
+
+// Profiles returns the names of all stored credentials profiles
+func Profiles() ([]string, error) {
+	store, err := CredentialStore()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	fyveDir := filepath.Join(homeDir, ".fyve")
-	if err := os.MkdirAll(fyveDir, 0700); err != nil {
+	return store.List()
+}
+
+// SaveAuthConfig saves the authentication configuration of the active profile to the credential store
+func SaveAuthConfig(authConfig AuthConfig) error {
+	store, err := CredentialStore()
+	if err != nil {
 		return err
 	}
 
-	configPath := filepath.Join(fyveDir, "config.json")
-
-	// Marshal the auth config to YAML
 	jsonData, err := json.Marshal(authConfig)
 	if err != nil {
 		return err
 	}
 
-	// Write to the file
-	if err := os.WriteFile(configPath, jsonData, 0600); err != nil {
-		return err
+	if err = store.Set(Profile(), jsonData); err != nil {
+		return fmt.Errorf("save credentials to %s store: %w", store.Name(), err)
 	}
 
 	return nil
 }
 
+// LoadAuthConfig loads the authentication configuration of the active profile
 func LoadAuthConfig() (*AuthConfig, error) {
-	homeDir, err := os.UserHomeDir()
+	return LoadProfileAuthConfig(Profile())
+}
+
+// LoadProfileAuthConfig loads the authentication configuration of the given profile
+func LoadProfileAuthConfig(profile string) (*AuthConfig, error) {
+	store, err := CredentialStore()
 	if err != nil {
 		return nil, err
 	}
 
-	fyveDir := filepath.Join(homeDir, ".fyve")
-	if err := os.MkdirAll(fyveDir, 0700); err != nil {
-		return nil, err
+	bytes, err := store.Get(profile)
+	if errors.Is(err, credentials.ErrNotFound) && profile == "default" && store.Name() != credentials.StoreFile {
+		bytes, err = migrateLegacyAuthConfig(store)
 	}
 
-	configPath := filepath.Join(fyveDir, "config.json")
-
-	bytes, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, err
 	}
@@ -69,3 +92,36 @@ func LoadAuthConfig() (*AuthConfig, error) {
 
 	return &authConfig, nil
 }
+
+// DeleteAuthConfig removes the credentials of the given profile from the credential store
+func DeleteAuthConfig(profile string) error {
+	store, err := CredentialStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Delete(profile)
+}
+
+// migrateLegacyAuthConfig moves a plain ~/.fyve/config.json written by older versions into store
+func migrateLegacyAuthConfig(store credentials.Store) ([]byte, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	legacyPath := filepath.Join(homeDir, ".fyve", "config.json")
+	bytes, err := os.ReadFile(legacyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, credentials.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = store.Set("default", bytes); err != nil {
+		return nil, fmt.Errorf("migrate %s to %s store: %w", legacyPath, store.Name(), err)
+	}
+
+	return bytes, os.Remove(legacyPath)
+}
@@ -1,26 +1,27 @@
 package config
 
 import (
-	"context"
-	"encoding/base64"
 	"fmt"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/ecr"
-	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
 	"os"
-	"os/exec"
 	"strings"
 )
 
 type Build struct {
 	appName       string
-	registry      string
+	repository    string
 	repositoryUri string // format 209479271613.dkr.ecr.us-east-1.amazonaws.com/fyve/fyve-learn
 	environment   string
 	image         string `yaml:"image"`
+	immutableTags bool
+	attestations  bool
+	pushLatest    bool
 }
 
 func (b *Build) GetRepositoryName() string {
+	if b.repository != "" {
+		return b.repository
+	}
+
 	name := b.appName
 	if !strings.HasPrefix(name, "fyve-") {
 		name = "fyve-" + name
@@ -48,81 +49,34 @@ func (b *Build) GetImage() string {
 	return b.image
 }
 
-func (b *Build) EnsureECRRepositoryExists(ctx context.Context, client *ecr.Client) error {
-	fmt.Println("Ensuring ECR repository exists...")
-	repositoryName := b.GetRepositoryName()
-	out, err := client.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{
-		RepositoryNames: []string{repositoryName},
-	})
-
-	if err == nil {
-		b.repositoryUri = *out.Repositories[0].RepositoryUri
-		return nil
-	}
-
-	// Repository doesn't exist, create it
-	fmt.Printf("Creating ECR repository '%s'...\n", repositoryName)
-
-	repo, err := client.CreateRepository(ctx, &ecr.CreateRepositoryInput{
-		RepositoryName:     aws.String(repositoryName),
-		ImageTagMutability: types.ImageTagMutabilityMutable,
-		ImageScanningConfiguration: &types.ImageScanningConfiguration{
-			ScanOnPush: false,
-		},
-	})
-
-	if err != nil {
-		return fmt.Errorf("failed to create ECR repository: %w", err)
-	}
-
-	b.repositoryUri = *repo.Repository.RepositoryUri
-
-	return nil
+// ImmutableTags reports whether the repository rejects pushing an existing tag again,
+// :latest is then not moved and images must be tagged with IMAGE_TAG or GITHUB_SHA
+func (b *Build) ImmutableTags() bool {
+	return b.immutableTags
 }
 
-func (b *Build) ECRLogin(ctx context.Context, client *ecr.Client) error {
-	fmt.Println("Authenticating with AWS ECR...")
-
-	output, err := client.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
-	if err != nil {
-		return fmt.Errorf("failed to get ECR authorization token: %w", err)
-	}
-
-	if len(output.AuthorizationData) == 0 {
-		return fmt.Errorf("no authorization data returned")
-	}
-
-	authData := output.AuthorizationData[0]
-	authToken := *authData.AuthorizationToken
-	b.registry = strings.TrimPrefix(*authData.ProxyEndpoint, "https://")
-
-	// Decode the token
-	decodedToken, err := base64.StdEncoding.DecodeString(authToken)
-	if err != nil {
-		return fmt.Errorf("failed to decode authorization token: %w", err)
-	}
-
-	// Format is "username:password"
-	tokenParts := strings.Split(string(decodedToken), ":")
-	if len(tokenParts) != 2 {
-		return fmt.Errorf("invalid token format")
-	}
-
-	username := tokenParts[0]
-	password := tokenParts[1]
+// Attestations reports whether images are built with an SBOM and provenance. BuildKit pushes them
+// while building, as the local image store cannot hold attestations.
+func (b *Build) Attestations() bool {
+	return b.attestations
+}
 
-	// Login with docker
-	dockerLoginCmd := exec.Command("docker", "login", "--username", username, "--password-stdin", b.registry)
-	dockerLoginCmd.Stdin = strings.NewReader(string(password))
+// PushLatest reports whether :latest is moved to the pushed image
+func (b *Build) PushLatest() bool {
+	return b.pushLatest
+}
 
-	_ = dockerLoginCmd.Run()
+// SetPushLatest moves :latest to the pushed image, repositories with immutable tags are left as is
+func (b *Build) SetPushLatest(pushLatest bool) {
+	b.pushLatest = pushLatest
+}
 
-	return nil
+// GetServiceImage returns the image url of a service built next to the app, tagged <tag>-<service>
+func (b *Build) GetServiceImage(service string) string {
+	return b.GetImage() + "-" + service
 }
 
-func (b *Build) ECRLogout() {
-	dockerLogoutCmd := exec.Command("docker", "logout", b.registry)
-	if err := dockerLogoutCmd.Run(); err != nil {
-		fmt.Printf("failed to run docker logout: %v", err)
-	}
+// SetRepositoryURI sets the repository images are pushed to, as returned by the registry
+func (b *Build) SetRepositoryURI(uri string) {
+	b.repositoryUri = uri
 }
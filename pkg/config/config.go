@@ -32,12 +32,27 @@ type Autoscaling struct {
 
 // AppConfig represents the application configuration
 type AppConfig struct {
-	App         string            `yaml:"app"`
-	Region      string            `yaml:"region,omitempty"`
-	Image       string            `yaml:"image"`
+	App    string `yaml:"app"`
+	Region string `yaml:"region,omitempty"`
+	Image  string `yaml:"image"`
+	// ImageTag is the human-readable reference of Image when it is pinned to a digest
+	ImageTag    string            `yaml:"-" mapstructure:"-"`
 	Port        int32             `yaml:"port,omitempty"`
 	Env         map[string]string `yaml:"env"`
 	Autoscaling Autoscaling       `yaml:"autoscaling"`
+	// Services are deployed next to the app container on the Docker target
+	Services map[string]ServiceConfig `yaml:"services,omitempty"`
+	Traefik  TraefikConfig            `yaml:"traefik,omitempty"`
+	Registry RegistryConfig           `yaml:"registry,omitempty"`
+	Security SecurityConfig           `yaml:"security,omitempty"`
+	Deploy   DeployConfig             `yaml:"deploy,omitempty"`
+	Secrets  SecretsConfig            `yaml:"secrets,omitempty"`
+	// SecretRefs are the secret references of Env the deployed values were resolved from, with
+	// SecretsSource, and SecretsHash the digest of these values, used by fyve secrets sync to
+	// detect rotations
+	SecretRefs    map[string]string `yaml:"-" mapstructure:"-"`
+	SecretsSource SecretsSource     `yaml:"-" mapstructure:"-"`
+	SecretsHash   string            `yaml:"-" mapstructure:"-"`
 }
 
 func (c *AppConfig) Validate() error {
@@ -53,9 +68,39 @@ func (c *AppConfig) Validate() error {
 		c.Autoscaling.ScaledownDelay = "15m"
 	}
 
-	_, err := time.ParseDuration(c.Autoscaling.ScaledownDelay)
+	if _, err := time.ParseDuration(c.Autoscaling.ScaledownDelay); err != nil {
+		return err
+	}
+
+	if err := c.Registry.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Traefik.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Security.validate(c.Registry); err != nil {
+		return err
+	}
 
-	return err
+	if err := c.Deploy.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Secrets.validate(); err != nil {
+		return err
+	}
+
+	return c.validateServices()
+}
+
+// PinImage deploys the image at pinned, a digest reference, keeping the current reference as ImageTag
+func (c *AppConfig) PinImage(pinned string) {
+	if c.ImageTag == "" {
+		c.ImageTag = c.Image
+	}
+	c.Image = pinned
 }
 
 func (c *AppConfig) SkipBuild() bool {
@@ -87,7 +132,11 @@ func LoadAppConfig() (*AppConfig, error) {
 
 func (c *AppConfig) BuildConfig() *Build {
 	return &Build{
-		appName: c.App,
+		appName:    c.App,
+		repository: c.Registry.Repository,
+		// only ECR repositories are immutable, other registries accept any tag
+		immutableTags: c.Registry.Type == RegistryECR && c.Registry.ECR.TagsImmutable(),
+		attestations:  c.Security.Attestations,
 	}
 }
 
@@ -100,6 +149,7 @@ type config struct {
 	// configFile is the config file location
 	configFile string
 	region     string
+	profile    string
 }
 
 func (c *config) ConfigFile() string {
@@ -128,6 +178,10 @@ func BootstrapConfig() error {
 	}
 
 	viper.SetConfigFile(GlobalConfig.ConfigFile())
+	if globalConfig.profile != "" {
+		viper.Set("profile", globalConfig.profile)
+	}
+
 	viper.AutomaticEnv() // read in environment variables that match
 	viper.SetEnvPrefix("FYVE")
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
@@ -135,12 +189,16 @@ func BootstrapConfig() error {
 	viper.SetDefault("domain", defaultDomain)
 	viper.SetDefault("dns.ttl", defaultRecordTTL)
 	viper.SetDefault("oidc.issuer.url", "https://auth.fyve.dev")
+	viper.SetDefault("oidc.client_id", "fyve-cli")
+	viper.SetDefault("oidc.cross_trust_client_id", "fyve-k3s")
+	viper.SetDefault("oidc.ci.audience", "api://FyveTokenExchange")
 
 	return nil
 }
 
 func AddBootstrapFlags(flags *flag.FlagSet) {
 	flags.StringVarP(&globalConfig.configFile, "config", "c", "", fmt.Sprintf("fyve configuration file (default: %s)", defaultConfigFile))
+	flags.StringVar(&globalConfig.profile, "profile", "", "Credentials profile to use (default: default)")
 }
 
 func convertMapKeysToUppercase(source map[string]string) map[string]string {
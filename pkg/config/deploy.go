@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// VerifySignatureConfig refuses to deploy images that are not signed by one of Keys
+type VerifySignatureConfig struct {
+	// Keys are cosign public keys, such as cosign.pub or awskms:///alias/fyve-signing, an image
+	// signed by any of them is deployed. Third-party images need a key of their publisher.
+	Keys []string `yaml:"keys"`
+}
+
+// DeployConfig holds the policies checked before a deploy
+type DeployConfig struct {
+	VerifySignature *VerifySignatureConfig `yaml:"verifySignature,omitempty" mapstructure:"verifySignature"`
+}
+
+func (d *DeployConfig) validate() error {
+	if v := d.VerifySignature; v != nil {
+		if len(v.Keys) == 0 {
+			return fmt.Errorf("deploy: verifySignature needs at least one key")
+		}
+
+		for _, key := range v.Keys {
+			if strings.TrimSpace(key) == "" {
+				return fmt.Errorf("deploy: verifySignature keys must not be empty")
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadDeployConfig reads the deploy block and the region of the configuration file, when there is
+// one, for commands deploying images they did not build, such as fyve update
+func LoadDeployConfig() (DeployConfig, string, error) {
+	_ = viper.ReadInConfig()
+
+	var c struct {
+		Region string
+		Deploy DeployConfig
+	}
+	if err := viper.Unmarshal(&c); err != nil {
+		return DeployConfig{}, "", err
+	}
+
+	return c.Deploy, c.Region, c.Deploy.validate()
+}
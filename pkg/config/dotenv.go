@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// plainDotenvValue matches values written to a dotenv file without quotes
+var plainDotenvValue = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+// EnvVar is an environment variable of a dotenv file, in the order of the file
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// ParseDotenv parses a dotenv file as Next.js, Vercel and Heroku write them: KEY=value lines
+// with an optional export prefix, # comments, single-quoted literal values and double-quoted
+// values with \n escapes, both of which may span lines. ${VAR} expansions are kept as is.
+func ParseDotenv(data []byte) ([]EnvVar, error) {
+	var vars []EnvVar
+
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=value", i+1)
+		}
+
+		value = strings.TrimLeft(value, " \t")
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			// unquoted, a # after a space starts a comment
+			if j := strings.Index(value, " #"); j >= 0 {
+				value = value[:j]
+			}
+			vars = append(vars, EnvVar{Name: name, Value: strings.TrimSpace(value)})
+			continue
+		}
+
+		quote := value[0]
+		start := i
+		value = value[1:]
+		for closing(value, quote) < 0 {
+			if i++; i == len(lines) {
+				return nil, fmt.Errorf("line %d: unterminated quoted value of %s", start+1, name)
+			}
+			value += "\n" + lines[i]
+		}
+		value = value[:closing(value, quote)]
+
+		if quote == '"' {
+			value = unescapeDotenv(value)
+		}
+		vars = append(vars, EnvVar{Name: name, Value: value})
+	}
+
+	return vars, nil
+}
+
+// closing returns the index of the quote ending s, -1 when s does not contain it.
+// Double quotes can be escaped with a backslash.
+func closing(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+
+	return -1
+}
+
+func unescapeDotenv(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`, `\$`, "$").Replace(s)
+}
+
+// FormatDotenv writes vars as a dotenv file that ParseDotenv and the dotenv libraries read back
+// unchanged. Values are single-quoted, so that $ is not expanded, unless they hold a single
+// quote or a line break, which are escaped in double quotes.
+func FormatDotenv(vars []EnvVar) string {
+	var b strings.Builder
+	for _, v := range vars {
+		value := v.Value
+		switch {
+		case plainDotenvValue.MatchString(value):
+		case !strings.ContainsAny(value, "'\n\r"):
+			value = "'" + value + "'"
+		default:
+			value = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`).Replace(value) + `"`
+		}
+
+		fmt.Fprintf(&b, "%s=%s\n", v.Name, value)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// SetEnv sets key in the env block of the configuration file to value, creating the file and
+// the block when needed. Comments and the order of the other keys are kept. It returns false
+// when key already had value.
+func SetEnv(file, key, value string) (bool, error) {
+	return SetEnvs(file, []EnvVar{{Name: key, Value: value}})
+}
+
+// SetEnvs sets vars in the env block of the configuration file like SetEnv, new keys are added
+// in the order of vars. It returns false when every key already had its value.
+func SetEnvs(file string, vars []EnvVar) (bool, error) {
+	return editEnv(file, func(env *yaml.Node) bool {
+		changed := false
+		for _, v := range vars {
+			i := mappingIndex(env, v.Name)
+			if i < 0 {
+				env.Content = append(env.Content, scalarNode(v.Name), scalarNode(v.Value))
+				changed = true
+				continue
+			}
+
+			node := env.Content[i+1]
+			if node.Kind == yaml.ScalarNode && node.Value == v.Value {
+				continue
+			}
+
+			// update the node in place to keep its comments
+			node.Kind, node.Tag, node.Style, node.Value, node.Content = yaml.ScalarNode, "!!str", 0, v.Value, nil
+			changed = true
+		}
+
+		return changed
+	})
+}
+
+// UnsetEnv removes key from the env block of the configuration file, it returns false when
+// key was not set
+func UnsetEnv(file, key string) (bool, error) {
+	return editEnv(file, func(env *yaml.Node) bool {
+		i := mappingIndex(env, key)
+		if i < 0 {
+			return false
+		}
+
+		env.Content = append(env.Content[:i], env.Content[i+2:]...)
+		return true
+	})
+}
+
+func editEnv(file string, edit func(env *yaml.Node) bool) (bool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false, fmt.Errorf("parse %s: %w", file, err)
+	}
+
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return false, fmt.Errorf("%s: expected a mapping at the top level", file)
+	}
+
+	i := mappingIndex(root, "env")
+	if i < 0 {
+		root.Content = append(root.Content, scalarNode("env"), &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+		i = len(root.Content) - 2
+	}
+
+	env := root.Content[i+1]
+	if env.Kind == yaml.ScalarNode && env.Tag == "!!null" {
+		// env: with no entries
+		env.Kind, env.Tag, env.Value = yaml.MappingNode, "!!map", ""
+	}
+	if env.Kind != yaml.MappingNode {
+		return false, fmt.Errorf("%s: env must be a mapping", file)
+	}
+
+	if !edit(env) {
+		return false, nil
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return false, err
+	}
+	if err := encoder.Close(); err != nil {
+		return false, err
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	return true, os.WriteFile(file, out.Bytes(), mode)
+}
+
+// mappingIndex returns the index of the key node of key in mapping, -1 when it is not set.
+// Keys are matched case-insensitively, as the configuration is read.
+func mappingIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if strings.EqualFold(mapping.Content[i].Value, key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"k8s.io/client-go/tools/clientcmd"
@@ -8,49 +11,62 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
-const defaultKubeconfigTemplate = "https://raw.githubusercontent.com/Fyve-Labs/fyve-cli/main/docs/kubeconfig/kubeconfig.tpl"
+// defaultKubeconfigTemplate is the kubeconfig template shipped with the binary
+//
+//go:embed kubeconfig.tpl
+var defaultKubeconfigTemplate []byte
 
-func LoadKubeconfig() (string, error) {
+const (
+	// maxKubeconfigTemplateSize limits how much is read from a remote template
+	maxKubeconfigTemplateSize = 1 << 20
+)
+
+// KubeconfigPath returns the location of the kubeconfig managed by fyve for the active profile
+func KubeconfigPath() (string, error) {
+	return ProfileKubeconfigPath(Profile())
+}
+
+// ProfileKubeconfigPath returns the location of the kubeconfig of profile, ~/.fyve/kubeconfig for
+// the default profile and ~/.fyve/kubeconfig.<profile> for the others
+func ProfileKubeconfigPath(profile string) (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
 
-	// Create directory if it doesn't exist
-	fyveDirPath := filepath.Join(homeDir, ".fyve")
-	if err = os.MkdirAll(fyveDirPath, 0755); err != nil {
-		return "", fmt.Errorf("error creating directory: %v", err)
+	name := "kubeconfig"
+	if profile != "default" {
+		name += "." + profile
 	}
 
+	return filepath.Join(homeDir, ".fyve", name), nil
+}
+
+func LoadKubeconfig() (string, error) {
 	// Path to save the kubeconfig file
-	kubeconfigPath := filepath.Join(fyveDirPath, "kubeconfig")
+	kubeconfigPath, err := KubeconfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	// Create directory if it doesn't exist, older versions created it world-readable
+	if err = os.MkdirAll(filepath.Dir(kubeconfigPath), 0700); err != nil {
+		return "", fmt.Errorf("error creating directory: %v", err)
+	}
+	_ = os.Chmod(filepath.Dir(kubeconfigPath), 0700)
 
 	// Check if the file already exists
 	if _, err = os.Stat(kubeconfigPath); os.IsNotExist(err) {
-		templateURL := os.Getenv("FYVE_KUBECONFIG_TEMPLATE")
-		if templateURL == "" {
-			templateURL = defaultKubeconfigTemplate
-		}
-
-		// Download the kubeconfig template
-		resp, err := http.Get(templateURL)
+		template, err := loadKubeconfigTemplate(os.Getenv("FYVE_KUBECONFIG_TEMPLATE"))
 		if err != nil {
-			return "", fmt.Errorf("error downloading kubeconfig template: %v", err)
+			return "", err
 		}
-		defer resp.Body.Close()
 
-		// Create the file
-		file, err := os.Create(kubeconfigPath)
-		if err != nil {
-			return "", fmt.Errorf("error creating kubeconfig file: %v", err)
-		}
-		defer file.Close()
-
-		// Copy the response body to the file
-		_, err = io.Copy(file, resp.Body)
-		if err != nil {
+		if err = os.WriteFile(kubeconfigPath, template, 0600); err != nil {
 			return "", fmt.Errorf("error writing to kubeconfig file: %v", err)
 		}
 	}
@@ -79,8 +95,24 @@ func LoadKubeconfig() (string, error) {
 		return "", fmt.Errorf("could not find token in auth config. Run \"fyve login\" to fix this issue and try again")
 	}
 
-	kubeconfig.AuthInfos[context.AuthInfo] = &api.AuthInfo{
-		Token: token,
+	// With an exec credential plugin the token is fetched from the credential store on demand
+	if authInfo, ok := kubeconfig.AuthInfos[context.AuthInfo]; ok && authInfo.Exec != nil {
+		changed := configureExecPlugin(authInfo.Exec, Profile())
+		if authInfo.Token == "" && !changed {
+			return kubeconfigPath, nil
+		}
+
+		authInfo.Token = ""
+	} else {
+		// Kubeconfigs written by older versions hold a copy of the token, move them to the plugin
+		if authInfo == nil {
+			authInfo = api.NewAuthInfo()
+			kubeconfig.AuthInfos[context.AuthInfo] = authInfo
+		}
+
+		authInfo.Exec = credentialHelperExecConfig()
+		configureExecPlugin(authInfo.Exec, Profile())
+		authInfo.Token = ""
 	}
 
 	err = clientcmd.WriteToFile(*kubeconfig, kubeconfigPath)
@@ -90,3 +122,142 @@ func LoadKubeconfig() (string, error) {
 
 	return kubeconfigPath, nil
 }
+
+// credentialHelperExecConfig returns the exec credential plugin of the embedded template, running
+// fyve credential-helper
+func credentialHelperExecConfig() *api.ExecConfig {
+	return &api.ExecConfig{
+		APIVersion:      "client.authentication.k8s.io/v1",
+		Command:         "fyve",
+		Args:            []string{"credential-helper"},
+		InteractiveMode: api.NeverExecInteractiveMode,
+	}
+}
+
+// configureExecPlugin points an exec plugin running fyve at the absolute path of this binary and
+// at profile. kubectl looks the command up in its own PATH, which may not contain fyve (e.g. ./fyve
+// in CI), and does not pass --profile or FYVE_PROFILE on. It returns whether the plugin changed.
+func configureExecPlugin(exec *api.ExecConfig, profile string) bool {
+	executable, err := os.Executable()
+	if err != nil {
+		return false
+	}
+
+	command := filepath.Base(exec.Command)
+	if exec.Command != executable && command != "fyve" && command != filepath.Base(executable) {
+		return false
+	}
+
+	changed := exec.Command != executable
+	exec.Command = executable
+
+	for i, arg := range exec.Args {
+		if arg == "--profile" && i+1 < len(exec.Args) {
+			if exec.Args[i+1] == profile {
+				return changed
+			}
+
+			exec.Args[i+1] = profile
+			return true
+		}
+	}
+
+	exec.Args = append(exec.Args, "--profile", profile)
+	return true
+}
+
+// loadKubeconfigTemplate returns the kubeconfig template to bootstrap ~/.fyve/kubeconfig with.
+// source may be empty (embedded template), a local file path or an https:// URL.
+func loadKubeconfigTemplate(source string) ([]byte, error) {
+	var (
+		template []byte
+		err      error
+	)
+
+	switch {
+	case source == "":
+		return defaultKubeconfigTemplate, nil
+	case strings.HasPrefix(source, "http://"):
+		return nil, fmt.Errorf("refusing to download kubeconfig template over plain http: %s", source)
+	case strings.HasPrefix(source, "https://"):
+		template, err = downloadKubeconfigTemplate(source)
+	default:
+		template, err = os.ReadFile(strings.TrimPrefix(source, "file://"))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig template %s: %w", source, err)
+	}
+
+	if err = verifyKubeconfigTemplate(template); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig template %s: %w", source, err)
+	}
+
+	return template, nil
+}
+
+func downloadKubeconfigTemplate(templateURL string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(templateURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxKubeconfigTemplateSize))
+}
+
+// verifyKubeconfigTemplate checks the template against the pinned checksum, if any, and makes sure it parses
+func verifyKubeconfigTemplate(template []byte) error {
+	if expected := os.Getenv("FYVE_KUBECONFIG_TEMPLATE_SHA256"); expected != "" {
+		sum := sha256.Sum256(template)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, expected) {
+			return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+		}
+	}
+
+	kubeconfig, err := clientcmd.Load(template)
+	if err != nil {
+		return err
+	}
+
+	if len(kubeconfig.Clusters) == 0 || len(kubeconfig.Contexts) == 0 {
+		return fmt.Errorf("no clusters or contexts defined")
+	}
+
+	return nil
+}
+
+// RemoveKubeconfigTokens clears bearer tokens that older versions copied into the kubeconfig of profile
+func RemoveKubeconfigTokens(profile string) (bool, error) {
+	kubeconfigPath, err := ProfileKubeconfigPath(profile)
+	if err != nil {
+		return false, err
+	}
+
+	kubeconfig, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not load %s: %w", kubeconfigPath, err)
+	}
+
+	removed := false
+	for _, authInfo := range kubeconfig.AuthInfos {
+		if authInfo.Token != "" {
+			authInfo.Token = ""
+			removed = true
+		}
+	}
+
+	if !removed {
+		return false, nil
+	}
+
+	return true, clientcmd.WriteToFile(*kubeconfig, kubeconfigPath)
+}
@@ -17,7 +17,9 @@ users:
   user:
     exec:
       apiVersion: client.authentication.k8s.io/v1
-      command: kubectl
+      args:
+      - credential-helper
+      command: fyve
       env: null
       interactiveMode: Never
       provideClusterInfo: false
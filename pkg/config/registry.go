@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// RegistryECR pushes to AWS ECR, creating the repository when needed
+	RegistryECR = "ecr"
+	// RegistryGHCR pushes to the GitHub Container Registry
+	RegistryGHCR = "ghcr"
+	// RegistryDocker pushes to a generic Docker registry v2, such as registry:2
+	RegistryDocker = "docker"
+)
+
+// RegistryConfig selects the registry built images are pushed to
+type RegistryConfig struct {
+	// Type is one of ecr, ghcr or docker, it defaults to ecr
+	Type string `yaml:"type,omitempty"`
+	// URL is the registry host and optional namespace, e.g. ghcr.io/my-org or localhost:5000,
+	// ECR derives it from the AWS account
+	URL string `yaml:"url,omitempty"`
+	// Repository overrides the repository name, it defaults to fyve/fyve-<app>
+	Repository string `yaml:"repository,omitempty"`
+	// ECR configures the repositories fyve creates and reconciles in ECR
+	ECR ECRConfig `yaml:"ecr,omitempty"`
+}
+
+// ECRConfig holds the settings of ECR repositories. Unset settings keep the ECR defaults on new
+// repositories and are left as they are on existing ones.
+type ECRConfig struct {
+	// ImmutableTags prevents overwriting tags, --push-latest is then ignored
+	ImmutableTags *bool `yaml:"immutable_tags,omitempty" mapstructure:"immutable_tags"`
+	ScanOnPush    *bool `yaml:"scan_on_push,omitempty" mapstructure:"scan_on_push"`
+	// KMSKey encrypts new repositories with a customer managed key, ECR cannot change the
+	// encryption of existing repositories
+	KMSKey    string       `yaml:"kms_key,omitempty" mapstructure:"kms_key"`
+	Lifecycle ECRLifecycle `yaml:"lifecycle,omitempty"`
+}
+
+// ECRLifecycle holds the rules expiring old images, zero disables a rule
+type ECRLifecycle struct {
+	// KeepShaTags keeps the last N images tagged sha-*, as pushed from CI. The images of services
+	// built from the app, tagged sha-*-<service>, count towards N.
+	KeepShaTags int `yaml:"keep_sha_tags,omitempty" mapstructure:"keep_sha_tags"`
+	// ExpireUntaggedDays expires untagged images N days after they were pushed
+	ExpireUntaggedDays int `yaml:"expire_untagged_days,omitempty" mapstructure:"expire_untagged_days"`
+}
+
+// TagsImmutable reports whether immutable_tags is set to true
+func (e ECRConfig) TagsImmutable() bool {
+	return e.ImmutableTags != nil && *e.ImmutableTags
+}
+
+// Enabled reports whether any lifecycle rule is set
+func (l ECRLifecycle) Enabled() bool {
+	return l.KeepShaTags > 0 || l.ExpireUntaggedDays > 0
+}
+
+func (r *RegistryConfig) validate() error {
+	if r.Type == "" {
+		r.Type = RegistryECR
+	}
+
+	r.URL = strings.TrimSuffix(strings.TrimPrefix(r.URL, "https://"), "/")
+	r.Repository = strings.Trim(r.Repository, "/")
+
+	if r.Type != RegistryECR && r.ECR != (ECRConfig{}) {
+		return fmt.Errorf("registry: ecr settings are only used with type ecr")
+	}
+
+	switch r.Type {
+	case RegistryECR:
+		if r.URL != "" {
+			return fmt.Errorf("registry: url is not used with ecr, the repository is created in the AWS account")
+		}
+
+		if r.ECR.Lifecycle.KeepShaTags < 0 || r.ECR.Lifecycle.ExpireUntaggedDays < 0 {
+			return fmt.Errorf("registry: ecr lifecycle values must be positive")
+		}
+	case RegistryGHCR:
+		if r.URL == "" {
+			return fmt.Errorf("registry: url is required for ghcr, e.g. ghcr.io/my-org")
+		}
+		if !strings.HasPrefix(r.URL, "ghcr.io/") {
+			return fmt.Errorf("registry: ghcr url must start with ghcr.io/")
+		}
+	case RegistryDocker:
+		if r.URL == "" {
+			return fmt.Errorf("registry: url is required for docker, e.g. registry.example.com")
+		}
+	default:
+		return fmt.Errorf("registry: unknown type %q, use %s, %s or %s", r.Type, RegistryECR, RegistryGHCR, RegistryDocker)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// AWSSecretsConfig configures an AWS secret backend
+type AWSSecretsConfig struct {
+	// Region defaults to the region of the app
+	Region string `yaml:"region,omitempty" json:"region,omitempty"`
+}
+
+// VaultConfig configures the HashiCorp Vault KV backend, the token is read from VAULT_TOKEN
+// or ~/.vault-token
+type VaultConfig struct {
+	// Address defaults to VAULT_ADDR
+	Address   string `yaml:"address,omitempty" json:"address,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	// KVVersion is the version of the KV secrets engine, 1 or 2, it defaults to 2
+	KVVersion int `yaml:"kv_version,omitempty" mapstructure:"kv_version" json:"kv_version,omitempty"`
+}
+
+// SecretsConfig configures the backends secret references in env are resolved from
+type SecretsConfig struct {
+	SSM            AWSSecretsConfig `yaml:"ssm,omitempty" json:"ssm"`
+	SecretsManager AWSSecretsConfig `yaml:"secretsmanager,omitempty" json:"secretsmanager"`
+	Vault          VaultConfig      `yaml:"vault,omitempty" json:"vault"`
+	// Local enables file: and env: references, meant for local development
+	Local bool `yaml:"local,omitempty" json:"local,omitempty"`
+}
+
+// SecretsSource is what the secrets of a deployed app were resolved with, fyve secrets sync
+// resolves them again from the same environment and backends
+type SecretsSource struct {
+	Environment string        `json:"environment"`
+	Region      string        `json:"region"`
+	Secrets     SecretsConfig `json:"secrets"`
+}
+
+func (s *SecretsConfig) validate() error {
+	if s.Vault.Address == "" {
+		s.Vault.Address = os.Getenv("VAULT_ADDR")
+	}
+
+	if s.Vault.KVVersion == 0 {
+		s.Vault.KVVersion = 2
+	}
+
+	if s.Vault.KVVersion != 1 && s.Vault.KVVersion != 2 {
+		return fmt.Errorf("secrets: vault kv_version must be 1 or 2")
+	}
+
+	return nil
+}
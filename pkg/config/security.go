@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultScanSeverity = "HIGH"
+	defaultScanTimeout  = "10m"
+)
+
+// ScanSeverities are the severities of scan findings, from the lowest to the highest
+var ScanSeverities = []string{"INFORMATIONAL", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// ScanConfig gates deploys on the vulnerability scan of the pushed image
+type ScanConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Severity fails the deploy on findings of this severity or higher, it defaults to HIGH
+	Severity string `yaml:"severity,omitempty"`
+	// Allowlist is a file of vulnerability IDs that do not fail the deploy, one per line
+	Allowlist string `yaml:"allowlist,omitempty"`
+	// Timeout is how long to wait for the scan to complete, it defaults to 10m
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+// SecurityConfig holds the security checks of a deploy
+type SecurityConfig struct {
+	Scan ScanConfig `yaml:"scan,omitempty"`
+	// Attestations builds images with an SBOM and SLSA provenance, pushed next to them
+	Attestations bool          `yaml:"attestations,omitempty"`
+	Signing      SigningConfig `yaml:"signing,omitempty"`
+}
+
+// SigningConfig signs pushed images with cosign, the signatures are stored in the registry
+type SigningConfig struct {
+	// Key is a cosign private key file or a KMS key, such as awskms:///alias/fyve-signing.
+	// A key file is decrypted with COSIGN_PASSWORD.
+	Key string `yaml:"key,omitempty"`
+}
+
+// ScanTimeout returns the parsed scan timeout
+func (s ScanConfig) ScanTimeout() time.Duration {
+	d, _ := time.ParseDuration(s.Timeout)
+	return d
+}
+
+func (s *SecurityConfig) validate(registry RegistryConfig) error {
+	scan := &s.Scan
+	if !scan.Enabled {
+		return nil
+	}
+
+	if registry.Type != RegistryECR {
+		return fmt.Errorf("security: scan uses ECR image scanning and needs the ecr registry")
+	}
+
+	scan.Severity = strings.ToUpper(scan.Severity)
+	if scan.Severity == "" {
+		scan.Severity = defaultScanSeverity
+	}
+
+	if !slices.Contains(ScanSeverities, scan.Severity) {
+		return fmt.Errorf("security: unknown scan severity %q, use one of %s", scan.Severity, strings.Join(ScanSeverities, ", "))
+	}
+
+	if scan.Timeout == "" {
+		scan.Timeout = defaultScanTimeout
+	}
+
+	if _, err := time.ParseDuration(scan.Timeout); err != nil {
+		return fmt.Errorf("security: invalid scan timeout: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ServiceBuild describes how to build a service image
+type ServiceBuild struct {
+	Context    string `yaml:"context"`
+	Dockerfile string `yaml:"dockerfile,omitempty"`
+}
+
+// ServiceConfig represents an additional container deployed next to the app on the Docker target
+type ServiceConfig struct {
+	Image     string            `yaml:"image,omitempty"`
+	ImageTag  string            `yaml:"-" mapstructure:"-"`
+	Build     *ServiceBuild     `yaml:"build,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty"`
+	Command   []string          `yaml:"command,omitempty"`
+	DependsOn []string          `yaml:"depends_on,omitempty" mapstructure:"depends_on"`
+	Volumes   []string          `yaml:"volumes,omitempty"`
+}
+
+// HasServiceBuilds reports whether any service is built from source
+func (c *AppConfig) HasServiceBuilds() bool {
+	for _, svc := range c.Services {
+		if svc.Build != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *AppConfig) validateServices() error {
+	for name, svc := range c.Services {
+		if name == "web" {
+			return fmt.Errorf("service name %q is reserved for the app container", name)
+		}
+
+		if (svc.Image == "") == (svc.Build == nil) {
+			return fmt.Errorf("service %s: exactly one of image or build is required", name)
+		}
+
+		if svc.Build != nil && svc.Build.Context == "" {
+			svc.Build.Context = "."
+		}
+
+		for _, dep := range svc.DependsOn {
+			if _, ok := c.Services[dep]; !ok {
+				return fmt.Errorf("service %s depends on unknown service %s", name, dep)
+			}
+		}
+
+		for _, volume := range svc.Volumes {
+			source := strings.SplitN(volume, ":", 2)[0]
+			if !strings.Contains(volume, ":") || (strings.ContainsAny(source, "/.") && !filepath.IsAbs(source)) {
+				return fmt.Errorf("service %s: volume %q must be <name>:<path> or <absolute host path>:<path>", name, volume)
+			}
+		}
+
+		svc.Env = convertMapKeysToUppercase(svc.Env)
+		c.Services[name] = svc
+	}
+
+	_, err := c.ServiceOrder()
+	return err
+}
+
+// ServiceOrder returns the service names sorted so that dependencies come first
+func (c *AppConfig) ServiceOrder() ([]string, error) {
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int, len(names))
+	order := make([]string, 0, len(names))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("services have a dependency cycle through %s", name)
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		for _, dep := range c.Services[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		order = append(order, name)
+
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultTraefikEntrypoint   = "websecure"
+	defaultTraefikCertResolver = "default"
+	defaultTraefikNetwork      = "public"
+)
+
+// BasicAuth protects the app with HTTP basic auth, users are htpasswd entries such as user:$apr1$...
+type BasicAuth struct {
+	Users []string `yaml:"users"`
+}
+
+// RateLimit limits the average requests per second per client, allowing bursts
+type RateLimit struct {
+	Average int `yaml:"average"`
+	Burst   int `yaml:"burst,omitempty"`
+}
+
+// TraefikMiddlewares configures the middlewares applied to the app's router
+type TraefikMiddlewares struct {
+	BasicAuth   *BasicAuth        `yaml:"basic_auth,omitempty" mapstructure:"basic_auth"`
+	RedirectWWW bool              `yaml:"redirect_www,omitempty" mapstructure:"redirect_www"`
+	RateLimit   *RateLimit        `yaml:"rate_limit,omitempty" mapstructure:"rate_limit"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+}
+
+// TraefikConfig configures how Traefik routes to the app on the Docker target
+type TraefikConfig struct {
+	// Hosts are served in prod in addition to <app>.<domain>
+	Hosts        []string           `yaml:"hosts,omitempty"`
+	PathPrefixes []string           `yaml:"path_prefixes,omitempty" mapstructure:"path_prefixes"`
+	Entrypoint   string             `yaml:"entrypoint,omitempty"`
+	CertResolver string             `yaml:"certresolver,omitempty"`
+	Network      string             `yaml:"network,omitempty"`
+	Middlewares  TraefikMiddlewares `yaml:"middlewares,omitempty"`
+}
+
+// Domain returns the base domain apps are served on
+func Domain() string {
+	return viper.GetString("domain")
+}
+
+func (t *TraefikConfig) validate() error {
+	if t.Entrypoint == "" {
+		t.Entrypoint = defaultTraefikEntrypoint
+	}
+
+	if t.CertResolver == "" {
+		t.CertResolver = defaultTraefikCertResolver
+	}
+
+	if t.Network == "" {
+		t.Network = defaultTraefikNetwork
+	}
+
+	for _, host := range t.Hosts {
+		if host == "" || strings.ContainsAny(host, "/:` ") {
+			return fmt.Errorf("traefik: invalid host %q", host)
+		}
+	}
+
+	for _, prefix := range t.PathPrefixes {
+		if !strings.HasPrefix(prefix, "/") || strings.Contains(prefix, "`") {
+			return fmt.Errorf("traefik: path prefix %q must start with /", prefix)
+		}
+	}
+
+	if auth := t.Middlewares.BasicAuth; auth != nil {
+		if len(auth.Users) == 0 {
+			return fmt.Errorf("traefik: basic_auth needs at least one user")
+		}
+
+		for _, user := range auth.Users {
+			if !strings.Contains(user, ":") || strings.Contains(user, ",") {
+				return fmt.Errorf("traefik: basic_auth users must be htpasswd entries like user:hash")
+			}
+		}
+	}
+
+	if limit := t.Middlewares.RateLimit; limit != nil && (limit.Average <= 0 || limit.Burst < 0) {
+		return fmt.Errorf("traefik: rate_limit average must be positive")
+	}
+
+	return nil
+}
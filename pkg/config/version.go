@@ -0,0 +1,19 @@
+package config
+
+import "runtime/debug"
+
+// version is set at release build time with -ldflags "-X github.com/fyve-labs/fyve-cli/pkg/config.version=..."
+var version string
+
+// Version returns the fyve version, falling back to the module version of the binary
+func Version() string {
+	if version != "" {
+		return version
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+
+	return "(devel)"
+}
@@ -0,0 +1,204 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const (
+	// PassphraseEnv holds the passphrase of the encrypted file store on headless hosts
+	PassphraseEnv = "FYVE_CREDENTIALS_PASSPHRASE"
+
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// encryptedFile is the on-disk format of an encrypted credential
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// encryptedFileStore keeps credentials in ~/.fyve/credentials/<name>.enc, encrypted with
+// AES-256-GCM using a key derived from a passphrase with scrypt.
+type encryptedFileStore struct {
+	dir        string
+	passphrase []byte
+}
+
+func newEncryptedFileStore(dir string) *encryptedFileStore {
+	return &encryptedFileStore{dir: filepath.Join(dir, "credentials")}
+}
+
+func (s *encryptedFileStore) Name() string {
+	return StoreEncryptedFile
+}
+
+func (s *encryptedFileStore) path(name string) string {
+	return filepath.Join(s.dir, name+".enc")
+}
+
+func (s *encryptedFileStore) Get(name string) ([]byte, error) {
+	raw, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file encryptedFile
+	if err = json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("corrupted credential file %s: %w", s.path(name), err)
+	}
+
+	if file.Version != 1 || file.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported credential file %s", s.path(name))
+	}
+
+	gcm, err := s.cipher(file.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := gcm.Open(nil, file.Nonce, file.Ciphertext, []byte(name))
+	if err != nil {
+		return nil, errors.New("failed to decrypt credentials, wrong passphrase?")
+	}
+
+	return data, nil
+}
+
+func (s *encryptedFileStore) Set(name string, data []byte) error {
+	file := encryptedFile{
+		Version: 1,
+		KDF:     "scrypt",
+		Salt:    make([]byte, 16),
+	}
+
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+
+	gcm, err := s.cipher(file.Salt)
+	if err != nil {
+		return err
+	}
+
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(file.Nonce); err != nil {
+		return err
+	}
+
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, data, []byte(name))
+
+	raw, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.path(name), raw, 0600)
+}
+
+func (s *encryptedFileStore) Delete(name string) error {
+	err := os.Remove(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (s *encryptedFileStore) List() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.enc"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, strings.TrimSuffix(filepath.Base(match), ".enc"))
+	}
+
+	return names, nil
+}
+
+// unlockable reports whether the passphrase can be read, from the environment or a terminal,
+// or whether credentials were already encrypted with it
+func (s *encryptedFileStore) unlockable() bool {
+	if os.Getenv(PassphraseEnv) != "" || term.IsTerminal(int(os.Stdin.Fd())) {
+		return true
+	}
+
+	names, err := s.List()
+	return err == nil && len(names) > 0
+}
+
+func (s *encryptedFileStore) cipher(salt []byte) (cipher.AEAD, error) {
+	passphrase, err := s.getPassphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// getPassphrase reads the passphrase from the environment or prompts for it once per process
+func (s *encryptedFileStore) getPassphrase() ([]byte, error) {
+	if s.passphrase != nil {
+		return s.passphrase, nil
+	}
+
+	if val := os.Getenv(PassphraseEnv); val != "" {
+		s.passphrase = []byte(val)
+		return s.passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("no passphrase for the encrypted credential store: set %s, or use FYVE_CREDENTIALS_STORE=file to opt in to plain file storage", PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Credentials passphrase: ")
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	s.passphrase = passphrase
+	return s.passphrase, nil
+}
@@ -0,0 +1,75 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultName = "default"
+
+// fileStore keeps credentials unencrypted, the default credentials live in ~/.fyve/config.json
+type fileStore struct {
+	dir string
+}
+
+func newFileStore(dir string) *fileStore {
+	return &fileStore{dir: dir}
+}
+
+func (s *fileStore) Name() string {
+	return StoreFile
+}
+
+func (s *fileStore) path(name string) string {
+	if name == defaultName {
+		return filepath.Join(s.dir, "config.json")
+	}
+
+	return filepath.Join(s.dir, "config."+name+".json")
+}
+
+func (s *fileStore) Get(name string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (s *fileStore) Set(name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.path(name), data, 0600)
+}
+
+func (s *fileStore) Delete(name string) error {
+	err := os.Remove(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (s *fileStore) List() ([]string, error) {
+	var names []string
+	if _, err := os.Stat(s.path(defaultName)); err == nil {
+		names = append(names, defaultName)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(s.dir, "config.*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, match := range matches {
+		names = append(names, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), "config."), ".json"))
+	}
+
+	return names, nil
+}
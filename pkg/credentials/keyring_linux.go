@@ -0,0 +1,302 @@
+//go:build linux
+
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	secretServiceDest       = "org.freedesktop.secrets"
+	secretServicePath       = "/org/freedesktop/secrets"
+	secretServiceInterface  = "org.freedesktop.Secret.Service"
+	secretItemInterface     = "org.freedesktop.Secret.Item"
+	secretCollectionDefault = "/org/freedesktop/secrets/aliases/default"
+	secretPromptInterface   = "org.freedesktop.Secret.Prompt"
+
+	keyringService = "fyve-cli"
+)
+
+// secret is the org.freedesktop.Secret.Secret struct (oayays)
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// keyringStore keeps credentials in the Secret Service (GNOME Keyring, KWallet) over D-Bus,
+// each operation runs in its own session on a connection closed when it returns
+type keyringStore struct{}
+
+// keyringSession is an open Secret Service session
+type keyringSession struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+func keyringAvailable() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return false
+	}
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	var hasOwner bool
+	err = conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, secretServiceDest).Store(&hasOwner)
+	if err == nil && hasOwner {
+		return true
+	}
+
+	// The service may be D-Bus activatable without running yet
+	var activatable []string
+	if err = conn.BusObject().Call("org.freedesktop.DBus.ListActivatableNames", 0).Store(&activatable); err != nil {
+		return false
+	}
+
+	for _, name := range activatable {
+		if name == secretServiceDest {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newKeyringStore() (*keyringStore, error) {
+	s, err := openKeyringSession()
+	if err != nil {
+		return nil, err
+	}
+	s.close()
+
+	return &keyringStore{}, nil
+}
+
+func openKeyringSession() (*keyringSession, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("connect to D-Bus session bus: %w", err)
+	}
+
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err = conn.Object(secretServiceDest, secretServicePath).
+		Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&output, &session)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open Secret Service session: %w", err)
+	}
+
+	return &keyringSession{conn: conn, session: session}, nil
+}
+
+// close closes the session and the connection it was opened on
+func (s *keyringSession) close() {
+	_ = s.conn.Object(secretServiceDest, s.session).Call("org.freedesktop.Secret.Session.Close", 0).Err
+	_ = s.conn.Close()
+}
+
+func (keyringStore) Name() string {
+	return StoreKeyring
+}
+
+func (keyringStore) Get(name string) ([]byte, error) {
+	s, err := openKeyringSession()
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+
+	item, err := s.find(map[string]string{"service": keyringService, "account": name})
+	if err != nil {
+		return nil, err
+	}
+
+	var sec secret
+	err = s.conn.Object(secretServiceDest, item).
+		Call(secretItemInterface+".GetSecret", 0, s.session).
+		Store(&sec)
+	if err != nil {
+		return nil, fmt.Errorf("read secret from keyring: %w", err)
+	}
+
+	return sec.Value, nil
+}
+
+func (keyringStore) Set(name string, data []byte) error {
+	s, err := openKeyringSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	if err = s.unlock([]dbus.ObjectPath{secretCollectionDefault}); err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant(fmt.Sprintf("Fyve credentials (%s)", name)),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(map[string]string{"service": keyringService, "account": name}),
+	}
+
+	sec := secret{
+		Session:     s.session,
+		Parameters:  []byte{},
+		Value:       data,
+		ContentType: "application/json",
+	}
+
+	var item, prompt dbus.ObjectPath
+	err = s.conn.Object(secretServiceDest, secretCollectionDefault).
+		Call("org.freedesktop.Secret.Collection.CreateItem", 0, properties, sec, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("write secret to keyring: %w", err)
+	}
+
+	return s.prompt(prompt)
+}
+
+func (keyringStore) Delete(name string) error {
+	s, err := openKeyringSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	item, err := s.find(map[string]string{"service": keyringService, "account": name})
+	if err != nil {
+		return err
+	}
+
+	var prompt dbus.ObjectPath
+	if err = s.conn.Object(secretServiceDest, item).Call(secretItemInterface+".Delete", 0).Store(&prompt); err != nil {
+		return fmt.Errorf("delete secret from keyring: %w", err)
+	}
+
+	return s.prompt(prompt)
+}
+
+func (keyringStore) List() ([]string, error) {
+	s, err := openKeyringSession()
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+
+	items, err := s.search(map[string]string{"service": keyringService})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		prop, err := s.conn.Object(secretServiceDest, item).GetProperty(secretItemInterface + ".Attributes")
+		if err != nil {
+			return nil, err
+		}
+
+		if attributes, ok := prop.Value().(map[string]string); ok && attributes["account"] != "" {
+			names = append(names, attributes["account"])
+		}
+	}
+
+	return names, nil
+}
+
+// find returns the first unlocked item matching the attributes, unlocking it if needed
+func (s *keyringSession) find(attributes map[string]string) (dbus.ObjectPath, error) {
+	items, err := s.search(attributes)
+	if err != nil {
+		return "", err
+	}
+
+	if len(items) == 0 {
+		return "", ErrNotFound
+	}
+
+	return items[0], nil
+}
+
+func (s *keyringSession) search(attributes map[string]string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := s.conn.Object(secretServiceDest, secretServicePath).
+		Call(secretServiceInterface+".SearchItems", 0, attributes).
+		Store(&unlocked, &locked)
+	if err != nil {
+		return nil, fmt.Errorf("search keyring: %w", err)
+	}
+
+	if len(locked) > 0 {
+		if err = s.unlock(locked); err != nil {
+			return nil, err
+		}
+		unlocked = append(unlocked, locked...)
+	}
+
+	return unlocked, nil
+}
+
+func (s *keyringSession) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := s.conn.Object(secretServiceDest, secretServicePath).
+		Call(secretServiceInterface+".Unlock", 0, objects).
+		Store(&unlocked, &prompt)
+	if err != nil {
+		return fmt.Errorf("unlock keyring: %w", err)
+	}
+
+	return s.prompt(prompt)
+}
+
+// prompt runs a Secret Service prompt, if any, and waits for the user to complete it
+func (s *keyringSession) prompt(prompt dbus.ObjectPath) error {
+	if prompt == "" || prompt == "/" {
+		return nil
+	}
+
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	err := s.conn.AddMatchSignal(dbus.WithMatchObjectPath(prompt), dbus.WithMatchInterface(secretPromptInterface))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = s.conn.RemoveMatchSignal(dbus.WithMatchObjectPath(prompt), dbus.WithMatchInterface(secretPromptInterface))
+	}()
+
+	if err = s.conn.Object(secretServiceDest, prompt).Call(secretPromptInterface+".Prompt", 0, "").Err; err != nil {
+		return err
+	}
+
+	for signal := range signals {
+		if signal.Path != prompt || signal.Name != secretPromptInterface+".Completed" {
+			continue
+		}
+
+		if len(signal.Body) == 0 {
+			return errors.New("invalid keyring prompt completion signal")
+		}
+
+		if dismissed, ok := signal.Body[0].(bool); ok && dismissed {
+			return errors.New("keyring prompt dismissed")
+		}
+
+		return nil
+	}
+
+	return errors.New("keyring connection closed")
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package credentials
+
+import (
+	"errors"
+	"runtime"
+)
+
+func keyringAvailable() bool {
+	return false
+}
+
+func newKeyringStore() (Store, error) {
+	return nil, errors.New("keyring credential store is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,74 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// StoreKeyring keeps credentials in the OS keyring (Secret Service on Linux)
+	StoreKeyring = "keyring"
+	// StoreEncryptedFile keeps credentials in a passphrase-encrypted file under ~/.fyve
+	StoreEncryptedFile = "encrypted-file"
+	// StoreFile keeps credentials as plain JSON in ~/.fyve/config.json
+	StoreFile = "file"
+)
+
+// ErrNotFound is returned when no credentials are stored under the requested name
+var ErrNotFound = errors.New("credentials not found")
+
+// Store persists credentials by name
+type Store interface {
+	// Name returns the backend name
+	Name() string
+	Get(name string) ([]byte, error)
+	Set(name string, data []byte) error
+	Delete(name string) error
+	// List returns the names of all stored credentials
+	List() ([]string, error)
+}
+
+// NewStore returns the credential store for the given backend.
+// An empty backend selects the OS keyring when available and the encrypted file when its
+// passphrase can be read. Headless hosts without a keyring or FYVE_CREDENTIALS_PASSPHRASE cannot
+// unlock the encrypted file, kubectl runs the credential helper without a terminal, so they have
+// to set the passphrase or opt in to the plain file.
+func NewStore(backend string) (Store, error) {
+	dir, err := fyveDir()
+	if err != nil {
+		return nil, err
+	}
+
+	switch backend {
+	case "":
+		if keyringAvailable() {
+			return newKeyringStore()
+		}
+
+		encrypted := newEncryptedFileStore(dir)
+		if encrypted.unlockable() {
+			return encrypted, nil
+		}
+
+		return nil, fmt.Errorf("no keyring available and no passphrase for the encrypted credential store: set %s, or set FYVE_CREDENTIALS_STORE=%s to store credentials unencrypted", PassphraseEnv, StoreFile)
+	case StoreKeyring:
+		return newKeyringStore()
+	case StoreEncryptedFile:
+		return newEncryptedFileStore(dir), nil
+	case StoreFile:
+		return newFileStore(dir), nil
+	}
+
+	return nil, fmt.Errorf("unknown credential store %q, expected one of %s, %s, %s", backend, StoreKeyring, StoreEncryptedFile, StoreFile)
+}
+
+func fyveDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".fyve"), nil
+}
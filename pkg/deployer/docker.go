@@ -1,128 +1,170 @@
 package deployer
 
 import (
+	"context"
 	"fmt"
+	dockercontainer "github.com/docker/docker/api/types/container"
 	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/fyve-labs/fyve-cli/pkg/docker"
+	"maps"
 	"os"
-	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultHealthTimeout is how long a new container may take to become healthy
+	defaultHealthTimeout = 2 * time.Minute
 )
 
 // DockerDeployer handles deploying to a remote Docker host
 type DockerDeployer struct {
-	appName     string
-	buildConfig *config.Build
-	env         map[string]string
-	appHost     string
-	remoteHost  string
+	appConfig        *config.AppConfig
+	env              map[string]string
+	appHost          string
+	domain           string
+	containerService *docker.ContainerService
 }
 
-// NewDockerDeployer creates a new Docker deployer
-func NewDockerDeployer(appName string, buildConfig *config.Build, remoteHost string, env map[string]string) (*DockerDeployer, error) {
-	appHost := fmt.Sprintf("%s.%s", appName, "fyve.dev")
+// NewDockerDeployer creates a new Docker deployer. env and the services' env must have their secrets resolved.
+func NewDockerDeployer(appConfig *config.AppConfig, remoteHost string, tlsOptions docker.ClientTLS, env map[string]string) (*DockerDeployer, error) {
+	domain := config.Domain()
+	appHost := fmt.Sprintf("%s.%s", appConfig.App, domain)
 	if customAppHost := os.Getenv("CUSTOM_APP_HOST"); customAppHost != "" {
 		appHost = customAppHost
 	}
 
+	containerService, err := docker.NewContainerService(remoteHost, tlsOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	return &DockerDeployer{
-		appName:     appName,
-		appHost:     appHost,
-		buildConfig: buildConfig,
-		env:         env,
-		remoteHost:  remoteHost,
+		appConfig:        appConfig,
+		appHost:          appHost,
+		domain:           domain,
+		env:              env,
+		containerService: containerService,
 	}, nil
 }
 
-// Deploy deploys the application to the remote Docker host
-func (d *DockerDeployer) Deploy(environment string, port int32) error {
-	imageName := d.buildConfig.GetImage()
-	containerName := fmt.Sprintf("%s-%s", d.appName, environment)
-	fmt.Printf("Deploying image %s to %s environment\n", imageName, environment)
+// Deploy deploys the application and its services to the remote Docker host as one unit
+func (d *DockerDeployer) Deploy(ctx context.Context, environment string) error {
+	appName := d.appConfig.App
+	containerName := fmt.Sprintf("%s-%s", appName, environment)
+	fmt.Printf("Deploying image %s to %s environment\n", d.appConfig.Image, environment)
 
-	// Prepare docker command with remote host if specified
-	dockerCmd := "docker"
-	if d.remoteHost != "" {
-		dockerCmd = fmt.Sprintf("docker -H %s", d.remoteHost)
+	// Every container of the app joins a private bridge network and reaches the others by service name
+	networkName := docker.GroupNetworkName(appName, environment)
+	if err := d.containerService.EnsureNetwork(ctx, networkName, docker.ManagedLabels(appName, environment)); err != nil {
+		return err
 	}
 
-	// Pull the image
-	pullCmd := exec.Command("sh", "-c", fmt.Sprintf("%s pull %s", dockerCmd, imageName))
-	pullCmd.Stdout = os.Stdout
-	pullCmd.Stderr = os.Stderr
-	if err := pullCmd.Run(); err != nil {
-		return fmt.Errorf("failed to pull image: %w", err)
+	order, err := d.appConfig.ServiceOrder()
+	if err != nil {
+		return err
 	}
 
-	// Check if container already exists and remove it
-	inspectCmd := exec.Command("sh", "-c", fmt.Sprintf("%s inspect %s", dockerCmd, containerName))
-	if inspectCmd.Run() == nil {
-		fmt.Printf("Container %s already exists, removing...\n", containerName)
-
-		// Stop the container
-		stopCmd := exec.Command("sh", "-c", fmt.Sprintf("%s stop %s", dockerCmd, containerName))
-		stopCmd.Stdout = os.Stdout
-		stopCmd.Stderr = os.Stderr
-		if err := stopCmd.Run(); err != nil {
-			return fmt.Errorf("failed to stop container: %w", err)
-		}
-
-		// Remove the container
-		rmCmd := exec.Command("sh", "-c", fmt.Sprintf("%s rm %s", dockerCmd, containerName))
-		rmCmd.Stdout = os.Stdout
-		rmCmd.Stderr = os.Stderr
-		if err := rmCmd.Run(); err != nil {
-			return fmt.Errorf("failed to remove container: %w", err)
-		}
+	specs := make([]docker.ContainerSpec, 0, len(order)+1)
+	for i, name := range order {
+		fmt.Printf("Adding service %s...\n", name)
+		spec := d.serviceSpec(name, d.appConfig.Services[name], environment, networkName)
+		spec.Config.Labels[docker.LabelOrder] = fmt.Sprintf("%03d", i)
+		specs = append(specs, spec)
 	}
 
-	// Create the base docker run command
-	runCmdArgs := []string{}
+	spec := docker.ContainerSpec{
+		Name: containerName,
+		Config: &dockercontainer.Config{
+			Image:  d.appConfig.Image,
+			Env:    envList(d.env, environment),
+			Labels: docker.ManagedLabels(appName, environment),
+		},
+		HostConfig: &dockercontainer.HostConfig{
+			RestartPolicy: dockercontainer.RestartPolicy{Name: dockercontainer.RestartPolicyAlways},
+		},
+		Networks: []docker.NetworkAttachment{{Name: networkName, Aliases: []string{"web"}}},
+	}
 
-	// Add host flag if remote host is specified
-	if d.remoteHost != "" {
-		runCmdArgs = append(runCmdArgs, "-H", d.remoteHost)
+	if d.appConfig.ImageTag != "" {
+		spec.Config.Labels[docker.LabelImage] = d.appConfig.ImageTag
 	}
 
-	// Add run command and basic options
-	runCmdArgs = append(runCmdArgs, "run", "-d", "--name", containerName)
+	routeName := fmt.Sprintf("%s-%s", appName, environment)
+	hosts := d.traefikHosts(environment)
+	fmt.Printf("Adding Traefik labels for %s...\n", strings.Join(hosts, ", "))
+	maps.Copy(spec.Config.Labels, traefikLabels(routeName, hosts, d.appConfig.Port, d.appConfig.Traefik))
+
+	// Attach to the Traefik network so that it can reach the container
+	fmt.Printf("Attaching container to '%s' network...\n", d.appConfig.Traefik.Network)
+	spec.Networks = append(spec.Networks, docker.NetworkAttachment{Name: d.appConfig.Traefik.Network})
+	specs = append(specs, spec)
 
-	// Add environment variables
-	for key, val := range d.env {
-		runCmdArgs = append(runCmdArgs, "-e", fmt.Sprintf("%s=%s", key, val))
+	fmt.Println("Starting containers...")
+	if _, err := d.containerService.ReplaceGroup(ctx, specs, docker.HealthCheck{Timeout: defaultHealthTimeout}); err != nil {
+		return fmt.Errorf("failed to deploy containers: %w", err)
 	}
 
-	// Add NODE_ENV
-	runCmdArgs = append(runCmdArgs, "-e", fmt.Sprintf("FYVE_ENV=%s", environment))
+	// Remove services that are no longer declared in fyve.yaml
+	group, err := d.containerService.Group(ctx, appName, environment)
+	if err != nil {
+		return err
+	}
 
-	routeName := fmt.Sprintf("%s-%s", d.appName, environment)
-	// Add Traefik labels for production environment
-	if environment == "prod" {
-		fmt.Println("Adding Traefik labels for production deployment...")
+	for _, container := range group {
+		service := container.Labels[docker.LabelService]
+		if _, ok := d.appConfig.Services[service]; service == "" || ok {
+			continue
+		}
 
-		// Add labels with proper escaping
-		runCmdArgs = append(runCmdArgs, "--label", "traefik.enable=true")
-		runCmdArgs = append(runCmdArgs, "--label", fmt.Sprintf("traefik.http.routers.%s.rule=Host(`%s`)", routeName, d.appHost))
-		runCmdArgs = append(runCmdArgs, "--label", fmt.Sprintf("traefik.http.routers.%s.tls.certresolver=default", routeName))
-		runCmdArgs = append(runCmdArgs, "--label", fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port=%d", routeName, port))
-		runCmdArgs = append(runCmdArgs, "--label", fmt.Sprintf("traefik.http.routers.%s.entrypoints=websecure", routeName))
+		fmt.Printf("Removing service %s...\n", service)
+		if err := d.containerService.Remove(ctx, container.ID); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Successfully deployed %s to %s environment\n", appName, environment)
+	return nil
+}
 
-		// Attach to "public" network for production deployments
-		fmt.Println("Attaching container to 'public' network...")
-		runCmdArgs = append(runCmdArgs, "--network", "public")
+func (d *DockerDeployer) serviceSpec(name string, svc config.ServiceConfig, environment, networkName string) docker.ContainerSpec {
+	labels := docker.ManagedLabels(d.appConfig.App, environment)
+	labels[docker.LabelService] = name
+	if svc.ImageTag != "" {
+		labels[docker.LabelImage] = svc.ImageTag
 	}
 
-	// Add restart policy and image name
-	runCmdArgs = append(runCmdArgs, "--restart", "always", imageName)
+	binds := make([]string, 0, len(svc.Volumes))
+	for _, volume := range svc.Volumes {
+		// Named volumes are scoped to the app, host paths are used as-is
+		if !strings.HasPrefix(volume, "/") {
+			volume = fmt.Sprintf("%s-%s-%s", d.appConfig.App, environment, volume)
+		}
+		binds = append(binds, volume)
+	}
 
-	// Run the docker command
-	fmt.Println("Starting container...")
-	runCmd := exec.Command("docker", runCmdArgs...)
-	runCmd.Stdout = os.Stdout
-	runCmd.Stderr = os.Stderr
+	return docker.ContainerSpec{
+		Name: fmt.Sprintf("%s-%s-%s", d.appConfig.App, environment, name),
+		Config: &dockercontainer.Config{
+			Image:  svc.Image,
+			Env:    envList(svc.Env, environment),
+			Cmd:    svc.Command,
+			Labels: labels,
+		},
+		HostConfig: &dockercontainer.HostConfig{
+			Binds:         binds,
+			RestartPolicy: dockercontainer.RestartPolicy{Name: dockercontainer.RestartPolicyAlways},
+		},
+		Networks: []docker.NetworkAttachment{{Name: networkName, Aliases: []string{name}}},
+	}
+}
 
-	if err := runCmd.Run(); err != nil {
-		return fmt.Errorf("failed to start container: %w", err)
+// envList converts env to KEY=value pairs, values are passed as-is through the API, no shell is involved
+func envList(env map[string]string, environment string) []string {
+	list := make([]string, 0, len(env)+1)
+	for key, val := range env {
+		list = append(list, fmt.Sprintf("%s=%s", key, val))
 	}
 
-	fmt.Printf("Successfully deployed %s to %s environment\n", d.appName, environment)
-	return nil
+	return append(list, fmt.Sprintf("FYVE_ENV=%s", environment))
 }
@@ -0,0 +1,113 @@
+package deployer
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+)
+
+// traefikHosts returns the hosts routed to the app, prod is served on <app>.<domain> and the
+// configured extra hosts, other environments on <app>-<env>.<domain>
+func (d *DockerDeployer) traefikHosts(environment string) []string {
+	if environment != "prod" {
+		return []string{fmt.Sprintf("%s-%s.%s", d.appConfig.App, environment, d.domain)}
+	}
+
+	return append([]string{d.appHost}, d.appConfig.Traefik.Hosts...)
+}
+
+// traefikLabels returns the labels routing the hosts to the app through Traefik
+func traefikLabels(routeName string, hosts []string, port int32, traefik config.TraefikConfig) map[string]string {
+	router := "traefik.http.routers." + routeName
+	labels := map[string]string{
+		"traefik.enable":             "true",
+		"traefik.docker.network":     traefik.Network,
+		router + ".entrypoints":      traefik.Entrypoint,
+		router + ".tls.certresolver": traefik.CertResolver,
+		fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", routeName): fmt.Sprintf("%d", port),
+	}
+
+	middlewares := traefikMiddlewareLabels(routeName, traefik.Middlewares, labels)
+	if len(middlewares) > 0 {
+		labels[router+".middlewares"] = strings.Join(middlewares, ",")
+	}
+
+	ruleHosts := slices.Clone(hosts)
+	if traefik.Middlewares.RedirectWWW {
+		// www hosts are routed too, so that they can be redirected
+		for _, host := range hosts {
+			if !strings.HasPrefix(host, "www.") {
+				ruleHosts = append(ruleHosts, "www."+host)
+			}
+		}
+	}
+
+	labels[router+".rule"] = traefikRule(ruleHosts, traefik.PathPrefixes)
+
+	return labels
+}
+
+// traefikMiddlewareLabels adds the middleware definitions to labels and returns their names in the
+// order they apply
+func traefikMiddlewareLabels(routeName string, m config.TraefikMiddlewares, labels map[string]string) []string {
+	var names []string
+	define := func(suffix string, options map[string]string) {
+		name := routeName + "-" + suffix
+		for key, val := range options {
+			labels[fmt.Sprintf("traefik.http.middlewares.%s.%s", name, key)] = val
+		}
+		names = append(names, name)
+	}
+
+	if m.RedirectWWW {
+		define("www", map[string]string{
+			"redirectregex.regex":       `^https?://www\.(.+)`,
+			"redirectregex.replacement": "https://${1}",
+			"redirectregex.permanent":   "true",
+		})
+	}
+
+	if m.RateLimit != nil {
+		options := map[string]string{"ratelimit.average": fmt.Sprintf("%d", m.RateLimit.Average)}
+		if m.RateLimit.Burst > 0 {
+			options["ratelimit.burst"] = fmt.Sprintf("%d", m.RateLimit.Burst)
+		}
+		define("ratelimit", options)
+	}
+
+	if m.BasicAuth != nil {
+		define("auth", map[string]string{"basicauth.users": strings.Join(m.BasicAuth.Users, ",")})
+	}
+
+	if len(m.Headers) > 0 {
+		options := make(map[string]string, len(m.Headers))
+		for name, val := range m.Headers {
+			options["headers.customresponseheaders."+http.CanonicalHeaderKey(name)] = val
+		}
+		define("headers", options)
+	}
+
+	return names
+}
+
+func traefikRule(hosts, pathPrefixes []string) string {
+	rules := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		rules = append(rules, fmt.Sprintf("Host(`%s`)", host))
+	}
+	rule := strings.Join(rules, " || ")
+
+	if len(pathPrefixes) == 0 {
+		return rule
+	}
+
+	prefixes := make([]string, 0, len(pathPrefixes))
+	for _, prefix := range pathPrefixes {
+		prefixes = append(prefixes, fmt.Sprintf("PathPrefix(`%s`)", prefix))
+	}
+
+	return fmt.Sprintf("(%s) && (%s)", rule, strings.Join(prefixes, " || "))
+}
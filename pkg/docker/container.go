@@ -10,6 +10,8 @@ import (
 	"github.com/pkg/errors"
 	"io"
 	"log/slog"
+	"strings"
+	"time"
 )
 
 type ContainerService struct {
@@ -18,13 +20,32 @@ type ContainerService struct {
 	sr             *serviceRestore
 }
 
-func NewContainerService(endpoint string) (*ContainerService, error) {
+// ClientTLS holds the client certificate and CA used to reach a Docker host over mutual TLS
+type ClientTLS struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// Enabled reports whether any TLS option is set
+func (t ClientTLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || t.CAFile != ""
+}
+
+func NewContainerService(endpoint string, tlsOptions ClientTLS) (*ContainerService, error) {
 	opts := make([]client.Opt, 0)
 	if endpoint != "" {
 		opts = append(opts, client.WithHost(endpoint))
 	}
 
 	opts = append(opts, client.FromEnv, client.WithAPIVersionNegotiation())
+	if tlsOptions.Enabled() {
+		if tlsOptions.CertFile == "" || tlsOptions.KeyFile == "" || tlsOptions.CAFile == "" {
+			return nil, errors.New("TLS requires a client certificate, key and CA")
+		}
+
+		opts = append(opts, client.WithTLSClientConfig(tlsOptions.CAFile, tlsOptions.CertFile, tlsOptions.KeyFile))
+	}
 	dockerClient, err := client.NewClientWithOpts(
 		opts...,
 	)
@@ -45,46 +66,134 @@ func NewContainerService(endpoint string) (*ContainerService, error) {
 	}, nil
 }
 
-func (c *ContainerService) ReCreate(ctx context.Context, containerNameOrId string, forcePullImage bool, imageTag string) (*dockercontainer.InspectResponse, error) {
-	container, err := c.client.ContainerInspect(ctx, containerNameOrId)
+// ReCreate replaces the container with a new one using imageTag. When the new container does not pass
+// check, the old container is restored unless noRollback is set, in which case it is kept stopped as <name>-old.
+func (c *ContainerService) ReCreate(ctx context.Context, containerNameOrId string, forcePullImage bool, imageTag string, check HealthCheck, noRollback bool) (*dockercontainer.InspectResponse, error) {
+	newContainers, err := c.ReCreateGroup(ctx, []ReCreateTarget{{NameOrId: containerNameOrId, ImageTag: imageTag}}, forcePullImage, check, noRollback)
 	if err != nil {
-		return nil, errors.Wrap(err, "fetch container information error")
+		return nil, err
 	}
 
-	img, err := images.ParseImage(images.ParseImageOptions{
-		Name: container.Config.Image,
-	})
-	if err != nil {
-		return nil, errors.Wrap(err, "parse image error")
+	return &newContainers[0], nil
+}
+
+// ReCreateTarget is a container to recreate and its new image tag, an empty tag keeps the current one
+type ReCreateTarget struct {
+	NameOrId string
+	ImageTag string
+	// Image is the new image reference, such as an image pinned to its digest, it takes
+	// precedence over ImageTag
+	Image string
+	// Service is set for the services of an app, the HTTP probe of the health check only applies
+	// to the app container
+	Service bool
+}
+
+// ReCreateGroup recreates the containers in order as one unit, each must become healthy before
+// the next one is recreated. Old containers are only removed once all new ones are healthy,
+// otherwise all of them are restored unless noRollback is set.
+func (c *ContainerService) ReCreateGroup(ctx context.Context, targets []ReCreateTarget, forcePullImage bool, check HealthCheck, noRollback bool) ([]dockercontainer.InspectResponse, error) {
+	c.sr.enable()
+	defer c.sr.close()
+	defer c.sr.restore(ctx)
+
+	newContainerIds := make([]string, 0, len(targets))
+	removeOld := make([]func(context.Context), 0, len(targets))
+	for _, target := range targets {
+		newContainerId, oldName, remove, err := c.recreate(ctx, target, forcePullImage)
+		if err != nil {
+			return nil, err
+		}
+
+		targetCheck := check
+		if target.Service {
+			targetCheck.URL = ""
+		}
+
+		// wait for the new container to become healthy, the restore stack brings the old one back otherwise
+		if err := c.WaitHealthy(ctx, newContainerId, targetCheck); err != nil {
+			if noRollback {
+				c.sr.disable()
+				return nil, errors.Wrapf(err, "new container is not healthy, rollback disabled, old container kept as %s", oldName)
+			}
+
+			return nil, errors.Wrap(err, "new container is not healthy, rolled back")
+		}
+
+		newContainerIds = append(newContainerIds, newContainerId)
+		removeOld = append(removeOld, remove)
 	}
 
-	if imageTag != "" {
-		if err := img.WithTag(imageTag); err != nil {
-			return nil, errors.Wrapf(err, "set image tag error %s", imageTag)
+	// delete the old containers
+	cleanupCtx, cancel := detachedContext(ctx)
+	defer cancel()
+	for _, remove := range removeOld {
+		remove(cleanupCtx)
+	}
+
+	c.sr.disable()
+
+	newContainers := make([]dockercontainer.InspectResponse, 0, len(newContainerIds))
+	for _, newContainerId := range newContainerIds {
+		newContainer, _, err := c.client.ContainerInspectWithRaw(ctx, newContainerId, true)
+		if err != nil {
+			return nil, errors.Wrap(err, "fetch new container information error")
 		}
 
-		container.Config.Image = img.FullName()
+		newContainers = append(newContainers, newContainer)
+	}
+
+	return newContainers, nil
+}
+
+// recreate stops the container and starts a new one in its place, pushing the steps to undo onto the
+// restore stack. It returns the new container ID, the name the old container is kept under and a
+// function removing the old container.
+func (c *ContainerService) recreate(ctx context.Context, target ReCreateTarget, forcePullImage bool) (string, string, func(context.Context), error) {
+	container, err := c.client.ContainerInspect(ctx, target.NameOrId)
+	if err != nil {
+		return "", "", nil, errors.Wrap(err, "fetch container information error")
+	}
+
+	image, err := targetImage(container.Config.Image, target)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	img, err := images.ParseImage(images.ParseImageOptions{
+		Name: image,
+	})
+	if err != nil {
+		return "", "", nil, errors.Wrap(err, "parse image error")
 	}
+	container.Config.Image = image
 
 	containerId := container.ID
+	oldName := strings.TrimPrefix(container.Name, "/") + oldSuffix
 
 	// 1. pull image if you need force pull
 	if forcePullImage {
 		if err := c.Pull(ctx, img); err != nil {
-			return nil, errors.Wrapf(err, "pull image error %s", img.FullName())
+			return "", "", nil, errors.Wrapf(err, "pull image error %s", img.FullName())
 		}
 	}
 
 	// 2. stop the current container
 	slog.Debug("starting to stop the container")
 	if err := c.client.ContainerStop(ctx, containerId, dockercontainer.StopOptions{}); err != nil {
-		return nil, errors.Wrap(err, "stop container error")
+		return "", "", nil, errors.Wrap(err, "stop container error")
 	}
 
-	// 3. rename the current container
+	c.sr.push(func(ctx context.Context) {
+		slog.Debug("restarting the container")
+		_ = c.client.ContainerStart(ctx, containerId, dockercontainer.StartOptions{})
+	})
+
+	// 3. rename the current container, replacing an old container an earlier update kept
 	slog.Debug("starting to rename the container")
-	if err := c.client.ContainerRename(ctx, containerId, container.Name+"-old"); err != nil {
-		return nil, errors.Wrap(err, "rename container error")
+	_ = c.client.ContainerRemove(ctx, oldName, dockercontainer.RemoveOptions{Force: true})
+	if err := c.client.ContainerRename(ctx, containerId, oldName); err != nil {
+		return "", "", nil, errors.Wrap(err, "rename container error")
 	}
 
 	initialNetwork := dockernetwork.NetworkingConfig{
@@ -95,7 +204,7 @@ func (c *ContainerService) ReCreate(ctx context.Context, containerNameOrId strin
 	for name, network := range container.NetworkSettings.Networks {
 		// This allows new container to use the same IP address if specified
 		if err := c.client.NetworkDisconnect(ctx, network.NetworkID, containerId, true); err != nil {
-			return nil, errors.Wrap(err, "disconnect network from old container error")
+			return "", "", nil, errors.Wrap(err, "disconnect network from old container error")
 		}
 
 		// 5. get the first network attached to the current container
@@ -106,19 +215,13 @@ func (c *ContainerService) ReCreate(ctx context.Context, containerNameOrId strin
 		}
 	}
 
-	c.sr.enable()
-	defer c.sr.close()
-	defer c.sr.restore()
-
-	c.sr.push(func() {
+	c.sr.push(func(ctx context.Context) {
 		slog.Debug("restoring the container")
 		_ = c.client.ContainerRename(ctx, containerId, container.Name)
 
 		for _, network := range container.NetworkSettings.Networks {
 			_ = c.client.NetworkConnect(ctx, network.NetworkID, containerId, network)
 		}
-
-		_ = c.client.ContainerStart(ctx, containerId, dockercontainer.StartOptions{})
 	})
 
 	slog.Debug("starting to create a new container")
@@ -126,14 +229,14 @@ func (c *ContainerService) ReCreate(ctx context.Context, containerNameOrId strin
 	// 6. create a new container
 	create, err := c.client.ContainerCreate(ctx, container.Config, container.HostConfig, &initialNetwork, nil, container.Name)
 
-	c.sr.push(func() {
+	c.sr.push(func(ctx context.Context) {
 		slog.Debug("removing the new container")
 		_ = c.client.ContainerStop(ctx, create.ID, dockercontainer.StopOptions{})
 		_ = c.client.ContainerRemove(ctx, create.ID, dockercontainer.RemoveOptions{})
 	})
 
 	if err != nil {
-		return nil, errors.Wrap(err, "create container error")
+		return "", "", nil, errors.Wrap(err, "create container error")
 	}
 
 	newContainerId := create.ID
@@ -150,28 +253,44 @@ func (c *ContainerService) ReCreate(ctx context.Context, containerNameOrId strin
 		}
 
 		if err := c.client.NetworkConnect(ctx, network.NetworkID, newContainerId, network); err != nil {
-			return nil, errors.Wrap(err, "connect container network error")
+			return "", "", nil, errors.Wrap(err, "connect container network error")
 		}
 	}
 
 	// 8. start the new container
 	slog.Debug("starting the new container")
 	if err := c.client.ContainerStart(ctx, newContainerId, dockercontainer.StartOptions{}); err != nil {
-		return nil, errors.Wrap(err, "start container error")
+		return "", "", nil, errors.Wrap(err, "start container error")
 	}
 
-	// 9. delete the old container
-	slog.Debug("starting to remove the old container")
-	_ = c.client.ContainerRemove(ctx, containerId, dockercontainer.RemoveOptions{})
+	removeOld := func(ctx context.Context) {
+		slog.Debug("starting to remove the old container")
+		_ = c.client.ContainerRemove(ctx, containerId, dockercontainer.RemoveOptions{})
+	}
 
-	c.sr.disable()
+	return newContainerId, oldName, removeOld, nil
+}
+
+// targetImage returns the image target recreates a container running image with
+func targetImage(image string, target ReCreateTarget) (string, error) {
+	if target.Image != "" {
+		return target.Image, nil
+	}
 
-	newContainer, _, err := c.client.ContainerInspectWithRaw(ctx, newContainerId, true)
+	if target.ImageTag == "" {
+		return image, nil
+	}
+
+	img, err := images.ParseImage(images.ParseImageOptions{Name: image})
 	if err != nil {
-		return nil, errors.Wrap(err, "fetch new container information error")
+		return "", errors.Wrap(err, "parse image error")
+	}
+
+	if err := img.WithTag(target.ImageTag); err != nil {
+		return "", errors.Wrapf(err, "set image tag error %s", target.ImageTag)
 	}
 
-	return &newContainer, nil
+	return img.FullName(), nil
 }
 
 func (c *ContainerService) Pull(ctx context.Context, img images.Image) error {
@@ -198,14 +317,23 @@ func (c *ContainerService) Pull(ctx context.Context, img images.Image) error {
 	return err
 }
 
+// restoreTimeout bounds the steps restoring the old containers and removing them, which run
+// after the context of the deploy may have been cancelled
+const restoreTimeout = 2 * time.Minute
+
+// detachedContext returns a context that outlives the cancellation of ctx, bounded by restoreTimeout
+func detachedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+}
+
 type serviceRestore struct {
 	restoreC chan struct{}
-	fs       []func()
+	fs       []func(ctx context.Context)
 }
 
 func (sr *serviceRestore) enable() {
 	sr.restoreC = make(chan struct{}, 1)
-	sr.fs = make([]func(), 0)
+	sr.fs = make([]func(ctx context.Context), 0)
 	sr.restoreC <- struct{}{}
 }
 
@@ -216,17 +344,22 @@ func (sr *serviceRestore) disable() {
 	}
 }
 
-func (sr *serviceRestore) push(f func()) {
+func (sr *serviceRestore) push(f func(ctx context.Context)) {
 	sr.fs = append(sr.fs, f)
 }
 
-func (sr *serviceRestore) restore() {
+// restore runs the pushed steps in reverse order with a context detached from ctx, which is
+// usually cancelled or timed out by then
+func (sr *serviceRestore) restore(ctx context.Context) {
 	select {
 	case <-sr.restoreC:
+		ctx, cancel := detachedContext(ctx)
+		defer cancel()
+
 		l := len(sr.fs)
 		if l > 0 {
 			for i := l - 1; i >= 0; i-- {
-				sr.fs[i]()
+				sr.fs[i](ctx)
 			}
 		}
 	default:
@@ -0,0 +1,398 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	dockercontainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	dockernetwork "github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/fyve-labs/fyve-cli/pkg/docker/images"
+	"github.com/pkg/errors"
+)
+
+const (
+	// LabelService holds the compose-style service name of a fyve-managed container, the app container has none
+	LabelService = "dev.fyve.service"
+	// LabelOrder holds the zero-padded position of a service in the deploy order
+	LabelOrder = "dev.fyve.order"
+)
+
+// NetworkAttachment is a network a container joins, with the aliases it is reachable under
+type NetworkAttachment struct {
+	Name    string
+	Aliases []string
+}
+
+// ContainerSpec describes a container to deploy
+type ContainerSpec struct {
+	Name       string
+	Config     *dockercontainer.Config
+	HostConfig *dockercontainer.HostConfig
+	// Networks to attach the container to, the first one is used when creating it
+	Networks []NetworkAttachment
+}
+
+// Replace deploys spec in place of the existing container of the same name. Containers routed
+// by Traefik are replaced without downtime: the new container is started next to the old one and
+// must become healthy before the old one is stopped, which moves the Traefik routes over to it.
+// Other containers, e.g. databases sharing a volume, are stopped before the new one is started.
+// On failure the new container is removed and the old one keeps serving under its original name.
+func (c *ContainerService) Replace(ctx context.Context, spec ContainerSpec, check HealthCheck) (*dockercontainer.InspectResponse, error) {
+	newContainers, err := c.ReplaceGroup(ctx, []ContainerSpec{spec}, check)
+	if err != nil {
+		return nil, err
+	}
+
+	return &newContainers[0], nil
+}
+
+// ReplaceGroup replaces the containers in order as one unit, each must become healthy before the
+// next one is started. Old containers are only removed once all new ones are healthy, otherwise
+// all new containers are removed and the old ones are started again.
+func (c *ContainerService) ReplaceGroup(ctx context.Context, specs []ContainerSpec, check HealthCheck) ([]dockercontainer.InspectResponse, error) {
+	c.sr.enable()
+	defer c.sr.close()
+	defer c.sr.restore(ctx)
+
+	newContainerIds := make([]string, 0, len(specs))
+	removeOld := make([]func(context.Context), 0, len(specs))
+	for _, spec := range specs {
+		newContainerId, remove, err := c.replace(ctx, spec, check)
+		if err != nil {
+			return nil, err
+		}
+
+		newContainerIds = append(newContainerIds, newContainerId)
+		removeOld = append(removeOld, remove)
+	}
+
+	// remove the old containers
+	cleanupCtx, cancel := detachedContext(ctx)
+	defer cancel()
+	for _, remove := range removeOld {
+		remove(cleanupCtx)
+	}
+
+	c.sr.disable()
+
+	newContainers := make([]dockercontainer.InspectResponse, 0, len(newContainerIds))
+	for _, newContainerId := range newContainerIds {
+		newContainer, err := c.client.ContainerInspect(ctx, newContainerId)
+		if err != nil {
+			return nil, errors.Wrap(err, "fetch new container information error")
+		}
+
+		newContainers = append(newContainers, newContainer)
+	}
+
+	return newContainers, nil
+}
+
+// replace starts spec in place of the existing container and waits for it to pass check, pushing
+// the steps to undo onto the restore stack. It returns the new container ID and a function
+// removing the old container, which is stopped by then.
+func (c *ContainerService) replace(ctx context.Context, spec ContainerSpec, check HealthCheck) (string, func(context.Context), error) {
+	img, err := images.ParseImage(images.ParseImageOptions{
+		Name: spec.Config.Image,
+	})
+	if err != nil {
+		return "", nil, errors.Wrap(err, "parse image error")
+	}
+
+	// 1. pull the image with registry auth
+	if err := c.Pull(ctx, img); err != nil {
+		return "", nil, errors.Wrapf(err, "pull image error %s", img.FullName())
+	}
+
+	// 2. find the current container, if any
+	oldContainer, err := c.client.ContainerInspect(ctx, spec.Name)
+	if err != nil && !client.IsErrNotFound(err) {
+		return "", nil, errors.Wrap(err, "fetch container information error")
+	}
+	hasOld := err == nil
+
+	// Only containers reached through Traefik can run next to their replacement, Traefik routes to
+	// both until the old one is stopped. Anything else, reached by network alias or sharing volumes,
+	// is stopped first.
+	overlap := hasOld && routedByTraefik(spec.Config.Labels) && routedByTraefik(oldContainer.Config.Labels)
+
+	stopOld := func() error {
+		slog.Debug("stopping the old container", "id", oldContainer.ID)
+		if err := c.client.ContainerStop(ctx, oldContainer.ID, dockercontainer.StopOptions{}); err != nil {
+			return errors.Wrap(err, "stop container error")
+		}
+
+		c.sr.push(func(ctx context.Context) {
+			slog.Debug("restarting the old container")
+			_ = c.client.ContainerStart(ctx, oldContainer.ID, dockercontainer.StartOptions{})
+		})
+
+		return nil
+	}
+
+	// 3. move the current container out of the way
+	if hasOld {
+		if !overlap {
+			if err := stopOld(); err != nil {
+				return "", nil, err
+			}
+		}
+
+		oldName := spec.Name + oldSuffix
+		slog.Debug("starting to rename the container", "name", oldName)
+		_ = c.client.ContainerRemove(ctx, oldName, dockercontainer.RemoveOptions{Force: true})
+		if err := c.client.ContainerRename(ctx, oldContainer.ID, oldName); err != nil {
+			return "", nil, errors.Wrap(err, "rename container error")
+		}
+
+		c.sr.push(func(ctx context.Context) {
+			slog.Debug("restoring the container")
+			_ = c.client.ContainerRename(ctx, oldContainer.ID, spec.Name)
+		})
+	}
+
+	networkingConfig := dockernetwork.NetworkingConfig{
+		EndpointsConfig: make(map[string]*dockernetwork.EndpointSettings),
+	}
+	if len(spec.Networks) > 0 {
+		networkingConfig.EndpointsConfig[spec.Networks[0].Name] = &dockernetwork.EndpointSettings{
+			Aliases: spec.Networks[0].Aliases,
+		}
+	}
+
+	// 4. create the new container
+	slog.Debug("starting to create a new container")
+	create, err := c.client.ContainerCreate(ctx, spec.Config, spec.HostConfig, &networkingConfig, nil, spec.Name)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "create container error")
+	}
+
+	c.sr.push(func(ctx context.Context) {
+		slog.Debug("removing the new container")
+		_ = c.client.ContainerRemove(ctx, create.ID, dockercontainer.RemoveOptions{Force: true})
+	})
+
+	// 5. connect the remaining networks, docker connects only one network at creation
+	for _, network := range spec.Networks[min(1, len(spec.Networks)):] {
+		endpoint := &dockernetwork.EndpointSettings{Aliases: network.Aliases}
+		if err := c.client.NetworkConnect(ctx, network.Name, create.ID, endpoint); err != nil {
+			return "", nil, errors.Wrapf(err, "connect container network error %s", network.Name)
+		}
+	}
+
+	// 6. start the new container
+	slog.Debug("starting the new container")
+	if err := c.client.ContainerStart(ctx, create.ID, dockercontainer.StartOptions{}); err != nil {
+		return "", nil, errors.Wrap(err, "start container error")
+	}
+
+	// 7. wait for it to become healthy, the restore stack brings the old one back otherwise
+	if err := c.WaitHealthy(ctx, create.ID, check); err != nil {
+		return "", nil, errors.Wrapf(err, "new container %s is not healthy", spec.Name)
+	}
+
+	// 8. move the Traefik routes over by stopping the old container, Traefik drops stopped containers
+	if overlap {
+		slog.Debug("moving the Traefik routes to the new container")
+		if err := stopOld(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	removeOld := func(ctx context.Context) {
+		if !hasOld {
+			return
+		}
+
+		slog.Debug("starting to remove the old container")
+		_ = c.client.ContainerRemove(ctx, oldContainer.ID, dockercontainer.RemoveOptions{})
+	}
+
+	return create.ID, removeOld, nil
+}
+
+// routedByTraefik reports whether labels expose the container through Traefik
+func routedByTraefik(labels map[string]string) bool {
+	return labels["traefik.enable"] == "true"
+}
+
+// EnsureNetwork creates a bridge network with the given labels unless it exists
+func (c *ContainerService) EnsureNetwork(ctx context.Context, name string, labels map[string]string) error {
+	_, err := c.client.NetworkInspect(ctx, name, dockernetwork.InspectOptions{})
+	if err == nil {
+		return nil
+	}
+
+	if !client.IsErrNotFound(err) {
+		return errors.Wrap(err, "fetch network information error")
+	}
+
+	slog.Debug("creating network", "name", name)
+	if _, err = c.client.NetworkCreate(ctx, name, dockernetwork.CreateOptions{Driver: "bridge", Labels: labels}); err != nil {
+		return errors.Wrapf(err, "create network error %s", name)
+	}
+
+	return nil
+}
+
+// Group returns the fyve-managed containers of an app in an environment, without the old
+// containers kept by update --no-rollback
+func (c *ContainerService) Group(ctx context.Context, appName, environment string) ([]dockercontainer.Summary, error) {
+	containers, err := c.listGroup(ctx, appName, environment)
+	if err != nil {
+		return nil, err
+	}
+
+	group := make([]dockercontainer.Summary, 0, len(containers))
+	for _, container := range containers {
+		if !isOld(container) {
+			group = append(group, container)
+		}
+	}
+
+	return group, nil
+}
+
+// listGroup returns all fyve-managed containers of an app in an environment
+func (c *ContainerService) listGroup(ctx context.Context, appName, environment string) ([]dockercontainer.Summary, error) {
+	containers, err := c.client.ContainerList(ctx, dockercontainer.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", LabelManaged+"=true"),
+			filters.Arg("label", LabelApp+"="+appName),
+			filters.Arg("label", LabelEnvironment+"="+environment),
+		),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list containers error")
+	}
+
+	return containers, nil
+}
+
+// RemoveGroup removes all containers of an app in an environment and its network, volumes are kept
+func (c *ContainerService) RemoveGroup(ctx context.Context, appName, environment string) ([]string, error) {
+	containers, err := c.listGroup(ctx, appName, environment)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]string, 0, len(containers))
+	for _, container := range containers {
+		if err := c.Remove(ctx, container.ID); err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, ContainerName(container))
+	}
+
+	networkName := GroupNetworkName(appName, environment)
+	if err := c.client.NetworkRemove(ctx, networkName); err != nil && !client.IsErrNotFound(err) {
+		return removed, errors.Wrapf(err, "remove network error %s", networkName)
+	}
+
+	return removed, nil
+}
+
+// GroupNetworkName returns the name of the bridge network shared by the containers of an app
+func GroupNetworkName(appName, environment string) string {
+	return appName + "-" + environment
+}
+
+// ReCreateApp recreates the container with imageTag together with the other containers of its app.
+// Services built from the app's repository move to <tag>-<service>, services using other images are
+// left untouched. Containers deployed without fyve labels are recreated on their own.
+func (c *ContainerService) ReCreateApp(ctx context.Context, containerNameOrId string, forcePullImage bool, imageTag string, check HealthCheck, noRollback bool) ([]dockercontainer.InspectResponse, error) {
+	targets, err := c.AppTargets(ctx, containerNameOrId, imageTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.ReCreateGroup(ctx, targets, forcePullImage, check, noRollback)
+}
+
+// AppTargets returns the containers ReCreateApp recreates for imageTag, in order, with the image
+// each of them moves to
+func (c *ContainerService) AppTargets(ctx context.Context, containerNameOrId string, imageTag string) ([]ReCreateTarget, error) {
+	container, err := c.client.ContainerInspect(ctx, containerNameOrId)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch container information error")
+	}
+
+	appName := container.Config.Labels[LabelApp]
+	environment := container.Config.Labels[LabelEnvironment]
+	if appName == "" || environment == "" {
+		return c.withTargetImages(ctx, []ReCreateTarget{{NameOrId: container.ID, ImageTag: imageTag}})
+	}
+
+	group, err := c.Group(ctx, appName, environment)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		web      *dockercontainer.Summary
+		services []dockercontainer.Summary
+	)
+	for i := range group {
+		if group[i].Labels[LabelService] == "" {
+			if web != nil {
+				return nil, fmt.Errorf("several app containers found for %s in %s: %s, %s", appName, environment, ContainerName(*web), ContainerName(group[i]))
+			}
+			web = &group[i]
+		} else {
+			services = append(services, group[i])
+		}
+	}
+
+	if web == nil {
+		return nil, fmt.Errorf("no app container found for %s in %s", appName, environment)
+	}
+
+	webImage, err := images.ParseImage(images.ParseImageOptions{Name: web.Image})
+	if err != nil {
+		return nil, errors.Wrap(err, "parse image error")
+	}
+
+	// Services are recreated before the app, in the order they were deployed in
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Labels[LabelOrder] < services[j].Labels[LabelOrder]
+	})
+
+	targets := make([]ReCreateTarget, 0, len(group))
+	for _, service := range services {
+		serviceImage, err := images.ParseImage(images.ParseImageOptions{Name: service.Image})
+		if err != nil {
+			return nil, errors.Wrap(err, "parse image error")
+		}
+
+		if imageTag == "" || serviceImage.Name() != webImage.Name() {
+			continue
+		}
+
+		targets = append(targets, ReCreateTarget{NameOrId: service.ID, ImageTag: imageTag + "-" + service.Labels[LabelService], Service: true})
+	}
+	targets = append(targets, ReCreateTarget{NameOrId: web.ID, ImageTag: imageTag})
+
+	return c.withTargetImages(ctx, targets)
+}
+
+// withTargetImages sets the Image of each target from the image its container is configured with
+func (c *ContainerService) withTargetImages(ctx context.Context, targets []ReCreateTarget) ([]ReCreateTarget, error) {
+	for i := range targets {
+		container, err := c.client.ContainerInspect(ctx, targets[i].NameOrId)
+		if err != nil {
+			return nil, errors.Wrap(err, "fetch container information error")
+		}
+
+		if targets[i].Image, err = targetImage(container.Config.Image, targets[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return targets, nil
+}
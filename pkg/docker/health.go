@@ -0,0 +1,164 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	dockercontainer "github.com/docker/docker/api/types/container"
+	"github.com/pkg/errors"
+)
+
+const (
+	// healthPollInterval is how often the container state is checked while waiting
+	healthPollInterval = time.Second
+	// noHealthcheckGracePeriod is how long a container without HEALTHCHECK must keep running
+	noHealthcheckGracePeriod = 5 * time.Second
+)
+
+// HealthCheck configures how a new container is checked before the old one is removed
+type HealthCheck struct {
+	// Timeout bounds the wait, zero skips the health check
+	Timeout time.Duration
+	// URL is probed over HTTP once the container is healthy, a 2xx or 3xx response passes
+	URL string
+}
+
+// WaitHealthy waits until the container reports a healthy Docker HEALTHCHECK status and, when
+// configured, answers the HTTP probe. Containers without a healthcheck are considered healthy
+// once they kept running for a short grace period without restarting.
+func (c *ContainerService) WaitHealthy(ctx context.Context, containerId string, check HealthCheck) error {
+	if check.Timeout <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	if err := c.waitContainerHealthy(ctx, containerId); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("container did not become healthy within %s", check.Timeout)
+		}
+
+		return err
+	}
+
+	if check.URL == "" {
+		return nil
+	}
+
+	if err := waitHTTPHealthy(ctx, check.URL); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s did not become healthy within %s: %w", check.URL, check.Timeout, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (c *ContainerService) waitContainerHealthy(ctx context.Context, containerId string) error {
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+
+	var (
+		started      time.Time
+		startedAt    string
+		restartCount int
+	)
+	for {
+		container, err := c.client.ContainerInspect(ctx, containerId)
+		if err != nil {
+			return errors.Wrap(err, "fetch container information error")
+		}
+
+		state := container.State
+		if state == nil {
+			return errors.New("container has no state")
+		}
+
+		if !state.Running && !state.Restarting {
+			return fmt.Errorf("container exited with code %d: %s", state.ExitCode, state.Error)
+		}
+
+		if state.Health == nil || state.Health.Status == dockercontainer.NoHealthcheck {
+			// Without a healthcheck the container must keep running, the restart policy may bring a
+			// crashing container back between two polls so the same run must last the whole period
+			if started.IsZero() {
+				started, startedAt, restartCount = time.Now(), state.StartedAt, container.RestartCount
+			}
+
+			if state.Restarting || state.StartedAt != startedAt || container.RestartCount != restartCount {
+				return fmt.Errorf("container restarted while starting (restart count %d)", container.RestartCount)
+			}
+
+			if state.Running && time.Since(started) >= noHealthcheckGracePeriod {
+				return nil
+			}
+		} else {
+			switch state.Health.Status {
+			case dockercontainer.Healthy:
+				return nil
+			case dockercontainer.Unhealthy:
+				return fmt.Errorf("container is unhealthy: %s", lastHealthOutput(state.Health))
+			}
+		}
+
+		slog.Debug("waiting for container to become healthy", "container", containerId)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitHTTPHealthy polls url until it answers with a 2xx or 3xx status
+func waitHTTPHealthy(ctx context.Context, url string) error {
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var lastErr error
+	for {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode < 400 {
+				return nil
+			}
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		lastErr = err
+
+		slog.Debug("waiting for health probe", "url", url, "error", err)
+		select {
+		case <-ctx.Done():
+			return lastErr
+		case <-ticker.C:
+		}
+	}
+}
+
+func lastHealthOutput(health *dockercontainer.Health) string {
+	if len(health.Log) == 0 {
+		return "no healthcheck output"
+	}
+
+	return strings.TrimSpace(health.Log[len(health.Log)-1].Output)
+}
@@ -0,0 +1,131 @@
+package images
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// dockerHubAuthKey is the key Docker stores Docker Hub credentials under
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// Credentials authenticate against a registry, empty credentials mean anonymous access
+type Credentials struct {
+	Username string
+	Password string
+}
+
+type dockerConfigFile struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// DockerConfigCredentials returns the credentials Docker uses for host, read from config.json
+// in $DOCKER_CONFIG or ~/.docker, including credential helpers and the credentials store
+func DockerConfigCredentials(host string) (Credentials, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credentials{}, err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return Credentials{}, nil
+	}
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "read docker config error")
+	}
+
+	var cfg dockerConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Credentials{}, errors.Wrap(err, "parse docker config error")
+	}
+
+	key := host
+	if host == "docker.io" || host == "registry-1.docker.io" {
+		key = dockerHubAuthKey
+	}
+
+	if helper := cfg.CredHelpers[key]; helper != "" {
+		return credentialHelper(helper, key)
+	}
+
+	for server, auth := range cfg.Auths {
+		if authHost(server) != authHost(key) {
+			continue
+		}
+
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Credentials{}, errors.Wrapf(err, "decode docker credentials for %s", host)
+			}
+
+			username, password, _ := strings.Cut(string(decoded), ":")
+			return Credentials{Username: username, Password: password}, nil
+		}
+
+		if auth.Username != "" {
+			return Credentials{Username: auth.Username, Password: auth.Password}, nil
+		}
+	}
+
+	if cfg.CredsStore != "" {
+		return credentialHelper(cfg.CredsStore, key)
+	}
+
+	return Credentials{}, nil
+}
+
+// credentialHelper asks docker-credential-<helper> for the credentials of server
+func credentialHelper(helper, server string) (Credentials, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		// helpers answer unknown servers with an error on stdout
+		if strings.Contains(string(out), "credentials not found") {
+			return Credentials{}, nil
+		}
+
+		return Credentials{}, fmt.Errorf("docker-credential-%s: %w: %s", helper, err, strings.TrimSpace(stderr.String()+string(out)))
+	}
+
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return Credentials{}, errors.Wrapf(err, "parse docker-credential-%s output", helper)
+	}
+
+	return Credentials{Username: creds.Username, Password: creds.Secret}, nil
+}
+
+// authHost strips the scheme and path of a config.json auths key
+func authHost(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	host, _, _ := strings.Cut(server, "/")
+
+	return host
+}
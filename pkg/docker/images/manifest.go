@@ -0,0 +1,221 @@
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// manifestMediaTypes are the manifest formats accepted when resolving a tag, indexes first so that
+// multi-platform images resolve to the digest of the index
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+var registryHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// ResolveDigest returns the digest of the manifest img's tag points to through the registry API.
+// Empty credentials use anonymous access.
+func ResolveDigest(ctx context.Context, img Image, creds Credentials) (digest.Digest, error) {
+	if img.Digest != "" {
+		return img.Digest, nil
+	}
+
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", RegistryURL(img.Domain), img.Path, img.Tag)
+
+	resp, err := headManifest(ctx, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := registryToken(ctx, resp.Header.Get("WWW-Authenticate"), creds)
+		if err != nil {
+			return "", err
+		}
+
+		if resp, err = headManifest(ctx, manifestURL, token); err != nil {
+			return "", err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("resolve digest of %s: registry returned %s", img.FullName(), resp.Status)
+	}
+
+	d, err := digest.Parse(resp.Header.Get("Docker-Content-Digest"))
+	if err != nil {
+		return "", errors.Wrapf(err, "resolve digest of %s", img.FullName())
+	}
+
+	return d, nil
+}
+
+// RegistryURL returns the base URL of the registry API at host. Like Docker, registries on
+// localhost are reached over plain HTTP, such as a local registry:2.
+func RegistryURL(host string) string {
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	if ip := net.ParseIP(hostname); hostname == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return "http://" + host
+	}
+
+	return "https://" + host
+}
+
+// PinImageDigest resolves image through its registry API and returns it as <name>@<digest>
+func PinImageDigest(ctx context.Context, image string) (string, error) {
+	img, err := ParseImage(ParseImageOptions{Name: image})
+	if err != nil {
+		return "", err
+	}
+
+	registryClient, err := NewRegistryClient()
+	if err != nil {
+		return "", err
+	}
+
+	creds, err := registryClient.Credentials(ctx, img)
+	if err != nil {
+		return "", fmt.Errorf("registry credentials for %s: %w", image, err)
+	}
+
+	d, err := ResolveDigest(ctx, img, creds)
+	if err != nil {
+		return "", err
+	}
+
+	return PinDigest(image, d)
+}
+
+// PinDigest returns name@digest for an image reference, dropping its tag
+func PinDigest(name string, d digest.Digest) (string, error) {
+	img, err := ParseImage(ParseImageOptions{Name: name})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s@%s", img.Name(), d), nil
+}
+
+func headManifest(ctx context.Context, manifestURL, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := registryHTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "registry request error")
+	}
+	_ = resp.Body.Close()
+
+	return resp, nil
+}
+
+// registryToken answers a registry's authentication challenge, returning the Authorization header
+func registryToken(ctx context.Context, challenge string, creds Credentials) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if creds.Username == "" {
+			return "", fmt.Errorf("registry requires credentials")
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+		req.SetBasicAuth(creds.Username, creds.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported registry authentication %q", scheme)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme != "https" {
+		return "", fmt.Errorf("invalid registry token realm %q", params["realm"])
+	}
+
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if creds.Username != "" {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	resp, err := registryHTTPClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "registry token request error")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token request returned %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", errors.Wrap(err, "decode registry token error")
+	}
+
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+
+	for rest != "" {
+		var key, val string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			val, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			val, rest, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = val
+	}
+
+	return scheme, params
+}
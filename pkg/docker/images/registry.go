@@ -5,13 +5,72 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
-	"strings"
+	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
+// ECRPublicHost is the registry of ECR Public, its tokens are issued in us-east-1 only
+const ECRPublicHost = "public.ecr.aws"
+
+// tokenExpiryMargin renews cached tokens before they expire, so that a long pull does not fail
+const tokenExpiryMargin = 5 * time.Minute
+
+var ecrHost = regexp.MustCompile(`^([0-9]{12})\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// ECRRegistry is an AWS ECR private registry, parsed from its hostname
+type ECRRegistry struct {
+	Account string
+	Region  string
+	FIPS    bool
+}
+
+// ParseECRHost returns the account and region of an ECR private registry host,
+// <account>.dkr.ecr.<region>.amazonaws.com
+func ParseECRHost(host string) (ECRRegistry, bool) {
+	m := ecrHost.FindStringSubmatch(host)
+	if m == nil {
+		return ECRRegistry{}, false
+	}
+
+	return ECRRegistry{Account: m[1], Region: m[3], FIPS: m[2] != ""}, true
+}
+
+// IsECR reports whether host is an AWS ECR private registry, <account>.dkr.ecr.<region>.amazonaws.com
+func IsECR(host string) bool {
+	return ecrHost.MatchString(host)
+}
+
+// IsECRPublic reports whether host is ECR Public
+func IsECRPublic(host string) bool {
+	return host == ECRPublicHost
+}
+
+// RegistryClient returns the credentials to pull images. ECR clients are created per account and
+// region, and their tokens are cached until they expire.
 type RegistryClient struct {
-	client *ecr.Client
+	awsConfig aws.Config
+	// roles are the role ARNs assumed to pull from other accounts, by account
+	roles map[string]string
+
+	mu      sync.Mutex
+	clients map[string]*ecr.Client
+	tokens  map[string]cachedCredentials
+}
+
+type cachedCredentials struct {
+	creds   Credentials
+	expires time.Time
 }
 
 type authHeader struct {
@@ -20,53 +79,192 @@ type authHeader struct {
 	ServerAddress string `json:"serveraddress"`
 }
 
+// NewRegistryClient loads the default AWS config. Cross-account ECR registries are pulled from by
+// assuming the roles in FYVE_ECR_ROLES, a comma-separated list of role ARNs matched by account.
 func NewRegistryClient() (*RegistryClient, error) {
-	awsConfig, err := awsconfig.LoadDefaultConfig(context.TODO(), awsconfig.WithRegion("us-east-1"))
+	awsConfig, err := awsconfig.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		return nil, fmt.Errorf("load AWS credentials error: %w", err)
 	}
 
-	client := ecr.NewFromConfig(awsConfig)
+	roles, err := parseRoles(os.Getenv("FYVE_ECR_ROLES"))
+	if err != nil {
+		return nil, err
+	}
+
 	registry := &RegistryClient{
-		client: client,
+		awsConfig: awsConfig,
+		roles:     roles,
+		clients:   make(map[string]*ecr.Client),
+		tokens:    make(map[string]cachedCredentials),
 	}
 
 	return registry, nil
 }
 
-func (r *RegistryClient) EncodedRegistryAuth(ctx context.Context, img Image) (header string, err error) {
-	if !strings.Contains(img.Domain, "ecr") {
-		return "", nil
+// parseRoles maps the account of each role ARN, arn:aws:iam::<account>:role/<name>, to the ARN
+func parseRoles(value string) (map[string]string, error) {
+	roles := make(map[string]string)
+	for _, arn := range strings.Split(value, ",") {
+		arn = strings.TrimSpace(arn)
+		if arn == "" {
+			continue
+		}
+
+		parts := strings.Split(arn, ":")
+		if len(parts) != 6 || parts[0] != "arn" || parts[2] != "iam" || !strings.HasPrefix(parts[5], "role/") {
+			return nil, fmt.Errorf("invalid role ARN %q in FYVE_ECR_ROLES", arn)
+		}
+		roles[parts[4]] = arn
+	}
+
+	return roles, nil
+}
+
+// Credentials returns the credentials for the registry of img. ECR uses an authorization token
+// of the region in its hostname, ECR Public a token when AWS credentials are available and
+// anonymous access otherwise. Other registries use the credentials Docker has for them.
+func (r *RegistryClient) Credentials(ctx context.Context, img Image) (Credentials, error) {
+	if registry, ok := ParseECRHost(img.Domain); ok {
+		return r.cachedToken(img.Domain, func() (string, *time.Time, error) {
+			return r.ecrToken(ctx, registry)
+		})
 	}
 
-	output, err := r.client.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	if IsECRPublic(img.Domain) {
+		creds, err := r.cachedToken(img.Domain, func() (string, *time.Time, error) {
+			return r.ecrPublicToken(ctx)
+		})
+		if err != nil {
+			// public images are pulled anonymously, a token only raises the rate limits
+			slog.Debug("using anonymous access to ECR Public", slog.String("error", err.Error()))
+			return Credentials{}, nil
+		}
+
+		return creds, nil
+	}
+
+	return DockerConfigCredentials(img.Domain)
+}
+
+// cachedToken returns the token of host, fetching a new one when it is missing or about to expire
+func (r *RegistryClient) cachedToken(host string, fetch func() (string, *time.Time, error)) (Credentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t, ok := r.tokens[host]; ok && time.Now().Before(t.expires) {
+		return t.creds, nil
+	}
+
+	token, expiresAt, err := fetch()
 	if err != nil {
-		return
+		return Credentials{}, err
+	}
+
+	creds, err := decodeAuthorizationToken(token)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if expiresAt != nil {
+		r.tokens[host] = cachedCredentials{creds: creds, expires: expiresAt.Add(-tokenExpiryMargin)}
+	}
+
+	return creds, nil
+}
+
+// ecrToken gets an authorization token from the region of registry, assuming the role
+// configured for its account
+func (r *RegistryClient) ecrToken(ctx context.Context, registry ECRRegistry) (string, *time.Time, error) {
+	output, err := r.ecrClient(registry).GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return "", nil, fmt.Errorf("get ECR token of %s in %s: %w", registry.Account, registry.Region, err)
 	}
 
 	if len(output.AuthorizationData) == 0 {
-		return "", fmt.Errorf("no authorization data returned")
+		return "", nil, fmt.Errorf("no authorization data returned")
 	}
 
-	authData := output.AuthorizationData[0]
-	authToken := *authData.AuthorizationToken
+	data := output.AuthorizationData[0]
+	return aws.ToString(data.AuthorizationToken), data.ExpiresAt, nil
+}
+
+func (r *RegistryClient) ecrPublicToken(ctx context.Context) (string, *time.Time, error) {
+	cfg := r.awsConfig.Copy()
+	cfg.Region = "us-east-1"
 
-	// Decode the token
-	decodedToken, err := base64.StdEncoding.DecodeString(authToken)
+	output, err := ecrpublic.NewFromConfig(cfg).GetAuthorizationToken(ctx, &ecrpublic.GetAuthorizationTokenInput{})
 	if err != nil {
-		return
+		return "", nil, fmt.Errorf("get ECR Public token: %w", err)
+	}
+
+	if output.AuthorizationData == nil {
+		return "", nil, fmt.Errorf("no authorization data returned")
+	}
+
+	return aws.ToString(output.AuthorizationData.AuthorizationToken), output.AuthorizationData.ExpiresAt, nil
+}
+
+// ecrClient returns the client of the region of registry, called with r.mu held
+func (r *RegistryClient) ecrClient(registry ECRRegistry) *ecr.Client {
+	key := registry.Region
+	if registry.FIPS {
+		key += "-fips"
 	}
 
-	// Format is "username:password"
-	tokenParts := strings.Split(string(decodedToken), ":")
-	if len(tokenParts) != 2 {
-		return "", fmt.Errorf("invalid token format")
+	role := r.roles[registry.Account]
+	if role != "" {
+		key = registry.Account + "/" + key
+	}
+
+	if client, ok := r.clients[key]; ok {
+		return client
+	}
+
+	cfg := r.awsConfig.Copy()
+	cfg.Region = registry.Region
+	if role != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), role, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "fyve-cli"
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	client := ecr.NewFromConfig(cfg, func(o *ecr.Options) {
+		if registry.FIPS {
+			o.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateEnabled
+		}
+	})
+	r.clients[key] = client
+
+	return client
+}
+
+// decodeAuthorizationToken splits an ECR token, base64 of "username:password"
+func decodeAuthorizationToken(token string) (Credentials, error) {
+	decodedToken, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	username, password, ok := strings.Cut(string(decodedToken), ":")
+	if !ok {
+		return Credentials{}, fmt.Errorf("invalid token format")
+	}
+
+	return Credentials{Username: username, Password: password}, nil
+}
+
+func (r *RegistryClient) EncodedRegistryAuth(ctx context.Context, img Image) (header string, err error) {
+	creds, err := r.Credentials(ctx, img)
+	if err != nil || creds.Username == "" {
+		return
 	}
 
 	authHeader := authHeader{
-		ServerAddress: *authData.ProxyEndpoint,
-		Username:      tokenParts[0],
-		Password:      tokenParts[1],
+		ServerAddress: img.Domain,
+		Username:      creds.Username,
+		Password:      creds.Password,
 	}
 
 	headerData, err := json.Marshal(authHeader)
@@ -0,0 +1,153 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	dockercontainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pkg/errors"
+)
+
+const (
+	// LabelManaged marks containers deployed by fyve
+	LabelManaged = "dev.fyve.managed"
+	// LabelApp holds the app name of a fyve-managed container
+	LabelApp = "dev.fyve.app"
+	// LabelEnvironment holds the environment of a fyve-managed container
+	LabelEnvironment = "dev.fyve.environment"
+	// LabelImage holds the human-readable image reference of a container pinned to a digest
+	LabelImage = "dev.fyve.image"
+
+	// oldSuffix is appended to the name of a container while it is replaced, update --no-rollback
+	// keeps it stopped under that name with the labels of the app
+	oldSuffix = "-old"
+)
+
+// ManagedLabels returns the labels fyve stamps on the containers it deploys
+func ManagedLabels(appName, environment string) map[string]string {
+	return map[string]string{
+		LabelManaged:     "true",
+		LabelApp:         appName,
+		LabelEnvironment: environment,
+	}
+}
+
+// List returns the fyve-managed containers, including stopped ones
+func (c *ContainerService) List(ctx context.Context) ([]dockercontainer.Summary, error) {
+	containers, err := c.client.ContainerList(ctx, dockercontainer.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelManaged+"=true")),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list containers error")
+	}
+
+	return containers, nil
+}
+
+// Find returns the fyve-managed container named nameOrApp, or the only container of app nameOrApp.
+// environment narrows the lookup by app name when set.
+func (c *ContainerService) Find(ctx context.Context, nameOrApp, environment string) (*dockercontainer.Summary, error) {
+	containers, err := c.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []dockercontainer.Summary
+	for _, container := range containers {
+		if environment != "" && container.Labels[LabelEnvironment] != environment {
+			continue
+		}
+
+		if ContainerName(container) == nameOrApp {
+			return &container, nil
+		}
+
+		// An app name resolves to the app container, not to the services deployed next to it or a kept old container
+		if container.Labels[LabelApp] == nameOrApp && container.Labels[LabelService] == "" && !isOld(container) {
+			matches = append(matches, container)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no fyve-managed container found for %s", nameOrApp)
+	case 1:
+		return &matches[0], nil
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, container := range matches {
+		names = append(names, ContainerName(container))
+	}
+
+	return nil, fmt.Errorf("%s matches several containers (%s), use --env or the container name", nameOrApp, strings.Join(names, ", "))
+}
+
+// Logs writes the container logs to stdout and stderr, following them when follow is set
+func (c *ContainerService) Logs(ctx context.Context, containerId string, follow bool, tail string, stdout, stderr io.Writer) error {
+	container, err := c.client.ContainerInspect(ctx, containerId)
+	if err != nil {
+		return errors.Wrap(err, "fetch container information error")
+	}
+
+	out, err := c.client.ContainerLogs(ctx, containerId, dockercontainer.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     follow,
+		Tail:       tail,
+	})
+	if err != nil {
+		return errors.Wrap(err, "fetch container logs error")
+	}
+	defer out.Close()
+
+	// Logs of containers with a TTY are not multiplexed
+	if container.Config != nil && container.Config.Tty {
+		_, err = io.Copy(stdout, out)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, out)
+	}
+
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	return nil
+}
+
+// Restart restarts the container
+func (c *ContainerService) Restart(ctx context.Context, containerId string) error {
+	if err := c.client.ContainerRestart(ctx, containerId, dockercontainer.StopOptions{}); err != nil {
+		return errors.Wrap(err, "restart container error")
+	}
+
+	return nil
+}
+
+// Remove stops and removes the container
+func (c *ContainerService) Remove(ctx context.Context, containerId string) error {
+	if err := c.client.ContainerRemove(ctx, containerId, dockercontainer.RemoveOptions{Force: true}); err != nil {
+		return errors.Wrap(err, "remove container error")
+	}
+
+	return nil
+}
+
+// ContainerName returns the primary name of the container without the leading slash
+func ContainerName(container dockercontainer.Summary) string {
+	if len(container.Names) == 0 {
+		return container.ID[:12]
+	}
+
+	return strings.TrimPrefix(container.Names[0], "/")
+}
+
+// isOld reports whether container is a previous container kept by update --no-rollback
+func isOld(container dockercontainer.Summary) bool {
+	return strings.HasSuffix(ContainerName(container), oldSuffix)
+}
@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/fyve-labs/fyve-cli/pkg/docker/images"
+)
+
+// DockerRegistry pushes to a Docker registry v2. Repositories are created on push, credentials
+// come from FYVE_REGISTRY_USERNAME and FYVE_REGISTRY_PASSWORD or the Docker config, including
+// its credential helpers.
+type DockerRegistry struct {
+	name     string
+	url      string
+	host     string
+	creds    images.Credentials
+	loggedIn bool
+}
+
+func newDockerRegistry(url string, creds images.Credentials) *DockerRegistry {
+	host, _, _ := strings.Cut(url, "/")
+	if creds.Username == "" {
+		creds = images.Credentials{
+			Username: os.Getenv("FYVE_REGISTRY_USERNAME"),
+			Password: os.Getenv("FYVE_REGISTRY_PASSWORD"),
+		}
+	}
+
+	return &DockerRegistry{
+		name:  config.RegistryDocker,
+		url:   url,
+		host:  host,
+		creds: creds,
+	}
+}
+
+func (r *DockerRegistry) Name() string {
+	return r.name
+}
+
+func (r *DockerRegistry) EnsureRepository(_ context.Context, name string) (string, error) {
+	return r.url + "/" + name, nil
+}
+
+func (r *DockerRegistry) RepositoryURI(_ context.Context, name string) (string, error) {
+	return r.url + "/" + name, nil
+}
+
+// Login stores the configured credentials, without them docker push uses the Docker config as is
+func (r *DockerRegistry) Login(_ context.Context) error {
+	if r.creds.Username == "" {
+		return nil
+	}
+
+	if err := dockerLogin(r.host, r.creds); err != nil {
+		return err
+	}
+	r.loggedIn = true
+
+	return nil
+}
+
+func (r *DockerRegistry) Logout() {
+	if r.loggedIn {
+		dockerLogout(r.host)
+	}
+}
+
+// PinImage resolves the digest through the registry API
+func (r *DockerRegistry) PinImage(ctx context.Context, image string) (string, error) {
+	creds := r.creds
+	if creds.Username == "" {
+		var err error
+		if creds, err = images.DockerConfigCredentials(r.host); err != nil {
+			return "", err
+		}
+	}
+
+	return pinImage(ctx, image, creds)
+}
+
+// newGHCR returns a registry for ghcr.io, authenticated with GITHUB_TOKEN (or GHCR_TOKEN) when set,
+// e.g. in GitHub Actions
+func newGHCR(url string) *DockerRegistry {
+	var creds images.Credentials
+	token := os.Getenv("GHCR_TOKEN")
+	if token == "" {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+
+	if token != "" {
+		// GHCR accepts any username with a token, GITHUB_ACTOR names the user in Actions
+		creds = images.Credentials{Username: os.Getenv("GITHUB_ACTOR"), Password: token}
+		if creds.Username == "" {
+			creds.Username = "fyve"
+		}
+	}
+
+	r := newDockerRegistry(url, creds)
+	r.name = config.RegistryGHCR
+
+	return r
+}
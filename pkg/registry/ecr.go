@@ -0,0 +1,322 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/fyve-labs/fyve-cli/pkg/docker/images"
+)
+
+// ECR pushes to AWS ECR in the account and region of the AWS config
+type ECR struct {
+	client   *ecr.Client
+	config   config.ECRConfig
+	registry string
+}
+
+func newECR(awsConfig aws.Config, cfg config.ECRConfig) *ECR {
+	return &ECR{client: ecr.NewFromConfig(awsConfig), config: cfg}
+}
+
+func (r *ECR) Name() string {
+	return config.RegistryECR
+}
+
+// EnsureRepository creates the repository with the settings of the registry.ecr block, or brings
+// an existing one in line with them
+func (r *ECR) EnsureRepository(ctx context.Context, repositoryName string) (string, error) {
+	fmt.Println("Ensuring ECR repository exists...")
+	out, err := r.client.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{
+		RepositoryNames: []string{repositoryName},
+	})
+
+	var notFound *types.RepositoryNotFoundException
+	switch {
+	case err == nil:
+		repo := out.Repositories[0]
+		if err := r.reconcile(ctx, repo); err != nil {
+			return "", err
+		}
+
+		return *repo.RepositoryUri, nil
+	case !errors.As(err, &notFound):
+		return "", fmt.Errorf("failed to describe ECR repository: %w", err)
+	}
+
+	// Repository doesn't exist, create it
+	fmt.Printf("Creating ECR repository '%s'...\n", repositoryName)
+
+	input := &ecr.CreateRepositoryInput{
+		RepositoryName:     aws.String(repositoryName),
+		ImageTagMutability: r.tagMutability(),
+		ImageScanningConfiguration: &types.ImageScanningConfiguration{
+			ScanOnPush: aws.ToBool(r.config.ScanOnPush),
+		},
+	}
+	if r.config.KMSKey != "" {
+		input.EncryptionConfiguration = &types.EncryptionConfiguration{
+			EncryptionType: types.EncryptionTypeKms,
+			KmsKey:         aws.String(r.config.KMSKey),
+		}
+	}
+
+	repo, err := r.client.CreateRepository(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create ECR repository: %w", err)
+	}
+
+	if err := r.putLifecyclePolicy(ctx, repositoryName); err != nil {
+		return "", err
+	}
+
+	return *repo.Repository.RepositoryUri, nil
+}
+
+func (r *ECR) RepositoryURI(ctx context.Context, repositoryName string) (string, error) {
+	out, err := r.client.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{
+		RepositoryNames: []string{repositoryName},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe ECR repository: %w", err)
+	}
+
+	return *out.Repositories[0].RepositoryUri, nil
+}
+
+func (r *ECR) tagMutability() types.ImageTagMutability {
+	if r.config.TagsImmutable() {
+		return types.ImageTagMutabilityImmutable
+	}
+
+	return types.ImageTagMutabilityMutable
+}
+
+// reconcile updates the settings of an existing repository that are set in the configuration
+// and differ from it, the settings left out are not touched
+func (r *ECR) reconcile(ctx context.Context, repo types.Repository) error {
+	name := repo.RepositoryName
+
+	if r.config.ImmutableTags != nil && repo.ImageTagMutability != r.tagMutability() {
+		fmt.Printf("Setting tag mutability of ECR repository '%s' to %s...\n", *name, r.tagMutability())
+		_, err := r.client.PutImageTagMutability(ctx, &ecr.PutImageTagMutabilityInput{
+			RepositoryName:     name,
+			ImageTagMutability: r.tagMutability(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update ECR tag mutability: %w", err)
+		}
+	}
+
+	scanOnPush := repo.ImageScanningConfiguration != nil && repo.ImageScanningConfiguration.ScanOnPush
+	if r.config.ScanOnPush != nil && scanOnPush != *r.config.ScanOnPush {
+		fmt.Printf("Setting scan on push of ECR repository '%s' to %t...\n", *name, *r.config.ScanOnPush)
+		_, err := r.client.PutImageScanningConfiguration(ctx, &ecr.PutImageScanningConfigurationInput{
+			RepositoryName:             name,
+			ImageScanningConfiguration: &types.ImageScanningConfiguration{ScanOnPush: *r.config.ScanOnPush},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update ECR scanning configuration: %w", err)
+		}
+	}
+
+	if r.config.KMSKey != "" {
+		enc := repo.EncryptionConfiguration
+		if enc == nil || enc.EncryptionType != types.EncryptionTypeKms || !kmsKeyMatches(aws.ToString(enc.KmsKey), r.config.KMSKey) {
+			fmt.Printf("Warning: ECR repository '%s' is not encrypted with %s, the encryption of an existing repository cannot be changed\n", *name, r.config.KMSKey)
+		}
+	}
+
+	return r.putLifecyclePolicy(ctx, *name)
+}
+
+// putLifecyclePolicy sets the lifecycle rules of the configuration, when the policy differs.
+// Without rules the policy of the repository is left untouched.
+func (r *ECR) putLifecyclePolicy(ctx context.Context, repositoryName string) error {
+	if !r.config.Lifecycle.Enabled() {
+		return nil
+	}
+
+	policy, err := lifecyclePolicy(r.config.Lifecycle)
+	if err != nil {
+		return err
+	}
+
+	current, err := r.client.GetLifecyclePolicy(ctx, &ecr.GetLifecyclePolicyInput{
+		RepositoryName: aws.String(repositoryName),
+	})
+	var notFound *types.LifecyclePolicyNotFoundException
+	switch {
+	case err == nil:
+		if sameJSON(aws.ToString(current.LifecyclePolicyText), policy) {
+			return nil
+		}
+	case !errors.As(err, &notFound):
+		return fmt.Errorf("failed to get ECR lifecycle policy: %w", err)
+	}
+
+	fmt.Printf("Updating lifecycle policy of ECR repository '%s'...\n", repositoryName)
+	_, err = r.client.PutLifecyclePolicy(ctx, &ecr.PutLifecyclePolicyInput{
+		RepositoryName:      aws.String(repositoryName),
+		LifecyclePolicyText: aws.String(policy),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put ECR lifecycle policy: %w", err)
+	}
+
+	return nil
+}
+
+type lifecycleRule struct {
+	RulePriority int                `json:"rulePriority"`
+	Description  string             `json:"description"`
+	Selection    lifecycleSelection `json:"selection"`
+	Action       lifecycleAction    `json:"action"`
+}
+
+type lifecycleSelection struct {
+	TagStatus     string   `json:"tagStatus"`
+	TagPrefixList []string `json:"tagPrefixList,omitempty"`
+	CountType     string   `json:"countType"`
+	CountUnit     string   `json:"countUnit,omitempty"`
+	CountNumber   int      `json:"countNumber"`
+}
+
+type lifecycleAction struct {
+	Type string `json:"type"`
+}
+
+// lifecyclePolicy returns the ECR lifecycle policy document of the configured rules
+func lifecyclePolicy(l config.ECRLifecycle) (string, error) {
+	var rules []lifecycleRule
+
+	if l.ExpireUntaggedDays > 0 {
+		rules = append(rules, lifecycleRule{
+			Description: fmt.Sprintf("Expire untagged images after %d days", l.ExpireUntaggedDays),
+			Selection: lifecycleSelection{
+				TagStatus:   "untagged",
+				CountType:   "sinceImagePushed",
+				CountUnit:   "days",
+				CountNumber: l.ExpireUntaggedDays,
+			},
+		})
+	}
+
+	if l.KeepShaTags > 0 {
+		rules = append(rules, lifecycleRule{
+			// sha-*-<service> images of the services built from the app match the prefix too
+			Description: fmt.Sprintf("Keep the last %d sha- tags", l.KeepShaTags),
+			Selection: lifecycleSelection{
+				TagStatus:     "tagged",
+				TagPrefixList: []string{"sha-"},
+				CountType:     "imageCountMoreThan",
+				CountNumber:   l.KeepShaTags,
+			},
+		})
+	}
+
+	for i := range rules {
+		rules[i].RulePriority = i + 1
+		rules[i].Action.Type = "expire"
+	}
+
+	b, err := json.Marshal(map[string][]lifecycleRule{"rules": rules})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode ECR lifecycle policy: %w", err)
+	}
+
+	return string(b), nil
+}
+
+// sameJSON reports whether two JSON documents are equal, ignoring formatting
+func sameJSON(a, b string) bool {
+	var va, vb any
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(va, vb)
+}
+
+// kmsKeyMatches compares the key ARN ECR returns with the configured key ARN or ID. Aliases are
+// not resolved and always match.
+func kmsKeyMatches(arn, key string) bool {
+	if strings.HasPrefix(key, "alias/") || strings.Contains(key, ":alias/") {
+		return true
+	}
+
+	return arn == key || strings.HasSuffix(arn, "/"+key)
+}
+
+func (r *ECR) Login(ctx context.Context) error {
+	fmt.Println("Authenticating with AWS ECR...")
+
+	output, err := r.client.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return fmt.Errorf("failed to get ECR authorization token: %w", err)
+	}
+
+	if len(output.AuthorizationData) == 0 {
+		return fmt.Errorf("no authorization data returned")
+	}
+
+	authData := output.AuthorizationData[0]
+	authToken := *authData.AuthorizationToken
+	r.registry = strings.TrimPrefix(*authData.ProxyEndpoint, "https://")
+
+	// Decode the token
+	decodedToken, err := base64.StdEncoding.DecodeString(authToken)
+	if err != nil {
+		return fmt.Errorf("failed to decode authorization token: %w", err)
+	}
+
+	// Format is "username:password"
+	tokenParts := strings.Split(string(decodedToken), ":")
+	if len(tokenParts) != 2 {
+		return fmt.Errorf("invalid token format")
+	}
+
+	return dockerLogin(r.registry, images.Credentials{Username: tokenParts[0], Password: tokenParts[1]})
+}
+
+func (r *ECR) Logout() {
+	if r.registry != "" {
+		dockerLogout(r.registry)
+	}
+}
+
+// PinImage looks the digest up with BatchGetImage
+func (r *ECR) PinImage(ctx context.Context, image string) (string, error) {
+	img, err := images.ParseImage(images.ParseImageOptions{Name: image})
+	if err != nil {
+		return "", err
+	}
+
+	out, err := r.client.BatchGetImage(ctx, &ecr.BatchGetImageInput{
+		RepositoryName: aws.String(img.Path),
+		ImageIds:       []types.ImageIdentifier{{ImageTag: aws.String(img.Tag)}},
+		AcceptedMediaTypes: []string{
+			"application/vnd.oci.image.index.v1+json",
+			"application/vnd.docker.distribution.manifest.list.v2+json",
+			"application/vnd.oci.image.manifest.v1+json",
+			"application/vnd.docker.distribution.manifest.v2+json",
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get image %s: %w", image, err)
+	}
+
+	if len(out.Images) == 0 || out.Images[0].ImageId == nil || out.Images[0].ImageId.ImageDigest == nil {
+		return "", fmt.Errorf("image %s not found in ECR", image)
+	}
+
+	return fmt.Sprintf("%s@%s", img.Name(), *out.Images[0].ImageId.ImageDigest), nil
+}
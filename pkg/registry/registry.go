@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/fyve-labs/fyve-cli/pkg/docker/images"
+)
+
+// Registry is where built images are pushed to
+type Registry interface {
+	// Name returns the registry type, one of config.RegistryECR, RegistryGHCR or RegistryDocker
+	Name() string
+	// EnsureRepository returns the URI of the repository name, creating it when the registry needs it
+	EnsureRepository(ctx context.Context, name string) (string, error)
+	// RepositoryURI returns the URI of the repository name without creating or changing it
+	RepositoryURI(ctx context.Context, name string) (string, error)
+	// Login authenticates docker push against the registry
+	Login(ctx context.Context) error
+	// Logout removes the credentials stored by Login
+	Logout()
+	// PinImage returns image pinned to the digest its tag points to, as <repository>@sha256:...
+	PinImage(ctx context.Context, image string) (string, error)
+}
+
+// New returns the registry selected by the registry block of fyve.yaml, awsConfig is used by ECR
+func New(cfg config.RegistryConfig, awsConfig aws.Config) (Registry, error) {
+	switch cfg.Type {
+	case config.RegistryECR, "":
+		return newECR(awsConfig, cfg.ECR), nil
+	case config.RegistryGHCR:
+		return newGHCR(cfg.URL), nil
+	case config.RegistryDocker:
+		return newDockerRegistry(cfg.URL, images.Credentials{}), nil
+	}
+
+	return nil, fmt.Errorf("unknown registry type %q", cfg.Type)
+}
+
+// dockerLogin stores creds for host in the Docker config, so that docker push can use them
+func dockerLogin(host string, creds images.Credentials) error {
+	cmd := exec.Command("docker", "login", "--username", creds.Username, "--password-stdin", host)
+	cmd.Stdin = strings.NewReader(creds.Password)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("docker login %s: %w: %s", host, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func dockerLogout(host string) {
+	dockerLogoutCmd := exec.Command("docker", "logout", host)
+	if err := dockerLogoutCmd.Run(); err != nil {
+		fmt.Printf("failed to run docker logout: %v", err)
+	}
+}
+
+// pinImage resolves image through the registry API with creds
+func pinImage(ctx context.Context, image string, creds images.Credentials) (string, error) {
+	img, err := images.ParseImage(images.ParseImageOptions{Name: image})
+	if err != nil {
+		return "", err
+	}
+
+	d, err := images.ResolveDigest(ctx, img, creds)
+	if err != nil {
+		return "", err
+	}
+
+	return images.PinDigest(image, d)
+}
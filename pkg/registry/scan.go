@@ -0,0 +1,153 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/fyve-labs/fyve-cli/pkg/docker/images"
+)
+
+// scanPollInterval is how often the scan status is checked while the scan is in progress
+const scanPollInterval = 5 * time.Second
+
+// Finding is a vulnerability found in an image
+type Finding struct {
+	// ID is the vulnerability ID, such as CVE-2024-1234
+	ID       string
+	Severity string
+	// Package is the affected package and version, empty for basic scanning
+	Package string
+	URI     string
+}
+
+// Scanner is implemented by registries that scan pushed images
+type Scanner interface {
+	// ScanFindings waits for the scan of image to complete and returns its findings
+	ScanFindings(ctx context.Context, image string) ([]Finding, error)
+}
+
+// ScanFindings returns the findings of ECR basic scanning or of Amazon Inspector when the
+// registry uses enhanced scanning. Without scan on push, a basic scan is started.
+func (r *ECR) ScanFindings(ctx context.Context, image string) ([]Finding, error) {
+	img, err := images.ParseImage(images.ParseImageOptions{Name: image})
+	if err != nil {
+		return nil, err
+	}
+
+	imageID := &types.ImageIdentifier{}
+	if img.Digest != "" {
+		imageID.ImageDigest = aws.String(img.Digest.String())
+	} else {
+		imageID.ImageTag = aws.String(img.Tag)
+	}
+
+	fmt.Printf("Waiting for the scan of %s...\n", image)
+	if err := r.waitForScan(ctx, img.Path, imageID); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	paginator := ecr.NewDescribeImageScanFindingsPaginator(r.client, &ecr.DescribeImageScanFindingsInput{
+		RepositoryName: aws.String(img.Path),
+		ImageId:        imageID,
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get scan findings of %s: %w", image, err)
+		}
+
+		if out.ImageScanFindings == nil {
+			continue
+		}
+
+		for _, f := range out.ImageScanFindings.Findings {
+			findings = append(findings, Finding{
+				ID:       aws.ToString(f.Name),
+				Severity: string(f.Severity),
+				URI:      aws.ToString(f.Uri),
+			})
+		}
+
+		for _, f := range out.ImageScanFindings.EnhancedFindings {
+			// Inspector keeps suppressed and closed findings
+			if status := aws.ToString(f.Status); status != "" && status != "ACTIVE" {
+				continue
+			}
+			findings = append(findings, enhancedFinding(f))
+		}
+	}
+
+	return findings, nil
+}
+
+// waitForScan polls the scan status until findings are available, until ctx is done
+func (r *ECR) waitForScan(ctx context.Context, repositoryName string, imageID *types.ImageIdentifier) error {
+	started := false
+	for {
+		out, err := r.client.DescribeImageScanFindings(ctx, &ecr.DescribeImageScanFindingsInput{
+			RepositoryName: aws.String(repositoryName),
+			ImageId:        imageID,
+			MaxResults:     aws.Int32(1),
+		})
+
+		var notFound *types.ScanNotFoundException
+		switch {
+		case errors.As(err, &notFound) && !started:
+			// scan on push is off, scan the image now
+			if _, err := r.client.StartImageScan(ctx, &ecr.StartImageScanInput{
+				RepositoryName: aws.String(repositoryName),
+				ImageId:        imageID,
+			}); err != nil {
+				return fmt.Errorf("failed to start image scan: %w", err)
+			}
+			started = true
+		case err != nil:
+			return fmt.Errorf("failed to get image scan status: %w", err)
+		case out.ImageScanStatus != nil:
+			switch out.ImageScanStatus.Status {
+			// enhanced scanning reports ACTIVE once the image has been scanned
+			case types.ScanStatusComplete, types.ScanStatusActive:
+				return nil
+			case types.ScanStatusInProgress, types.ScanStatusPending:
+			default:
+				return fmt.Errorf("image scan %s: %s", out.ImageScanStatus.Status, aws.ToString(out.ImageScanStatus.Description))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("image scan did not complete: %w", ctx.Err())
+		case <-time.After(scanPollInterval):
+		}
+	}
+}
+
+func enhancedFinding(f types.EnhancedImageScanFinding) Finding {
+	finding := Finding{
+		ID:       aws.ToString(f.Title),
+		Severity: aws.ToString(f.Severity),
+	}
+
+	if details := f.PackageVulnerabilityDetails; details != nil {
+		if id := aws.ToString(details.VulnerabilityId); id != "" {
+			finding.ID = id
+		}
+		finding.URI = aws.ToString(details.SourceUrl)
+
+		if len(details.VulnerablePackages) > 0 {
+			pkg := details.VulnerablePackages[0]
+			finding.Package = aws.ToString(pkg.Name)
+			if version := aws.ToString(pkg.Version); version != "" {
+				finding.Package += "@" + version
+			}
+		}
+	}
+
+	return finding
+}
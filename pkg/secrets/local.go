@@ -0,0 +1,55 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+)
+
+// FileProvider reads secrets from local files, for local development
+type FileProvider struct{}
+
+// GetSecret returns the content of the file at ref without its trailing newline. With
+// path#key, the file is a dotenv file and the value of key is returned.
+func (FileProvider) GetSecret(_ context.Context, ref string) (string, error) {
+	path, key := splitKey(ref)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	if key == "" {
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	vars, err := config.ParseDotenv(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	// the last assignment wins, as with the dotenv libraries
+	for i := len(vars) - 1; i >= 0; i-- {
+		if vars[i].Name == key {
+			return vars[i].Value, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s has no key %q", path, key)
+}
+
+// EnvProvider reads secrets from environment variables of the fyve process, for local development
+type EnvProvider struct{}
+
+// GetSecret returns the value of the environment variable ref
+func (EnvProvider) GetSecret(_ context.Context, ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,271 @@
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+)
+
+// Schemes of secret references, such as ssm:/app-name/{environment}/DATABASE_URL
+const (
+	SchemeSSM            = "ssm"
+	SchemeSecret         = "secret" // SSM, kept for existing configurations
+	SchemeSecretsManager = "secretsmanager"
+	SchemeVault          = "vault"
+	SchemeFile           = "file"
+	SchemeEnv            = "env"
+)
+
+// maxParallelLookups bounds the concurrent lookups of a provider without batches
+const maxParallelLookups = 8
+
+// SecretProvider resolves the secret references of a scheme
+type SecretProvider interface {
+	// GetSecret returns the value of ref, the reference without its scheme
+	GetSecret(ctx context.Context, ref string) (string, error)
+}
+
+// BatchProvider is implemented by providers that resolve several references in one call
+type BatchProvider interface {
+	SecretProvider
+	// GetSecrets returns the values of refs by reference. The error reports every reference
+	// that could not be resolved.
+	GetSecrets(ctx context.Context, refs []string) (map[string]string, error)
+}
+
+// Resolver resolves secret references in env, dispatching on their scheme
+type Resolver struct {
+	providers map[string]SecretProvider
+}
+
+// NewResolver returns a resolver for the backends of cfg, AWS backends use awsConfig unless
+// they set their own region. file: and env: references are resolved when cfg.Local is set.
+func NewResolver(cfg config.SecretsConfig, awsConfig aws.Config) (*Resolver, error) {
+	ssmManager, err := NewSSMManagerFromConfig(cfg, awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	secretsManager := NewSecretsManager(secretsmanager.NewFromConfig(withRegion(awsConfig, cfg.SecretsManager.Region), func(o *secretsmanager.Options) {
+		o.Retryer = throttlingRetryer()
+	}))
+
+	r := &Resolver{
+		providers: map[string]SecretProvider{
+			SchemeSSM:            ssmManager,
+			SchemeSecret:         ssmManager,
+			SchemeSecretsManager: secretsManager,
+			SchemeVault:          NewVault(cfg.Vault),
+		},
+	}
+
+	if cfg.Local {
+		r.providers[SchemeFile] = FileProvider{}
+		r.providers[SchemeEnv] = EnvProvider{}
+	}
+
+	return r, nil
+}
+
+// NewSSMManagerFromConfig returns the Parameter Store backend of cfg
+func NewSSMManagerFromConfig(cfg config.SecretsConfig, awsConfig aws.Config) (*SSMManager, error) {
+	return NewSSMManager(ssm.NewFromConfig(withRegion(awsConfig, cfg.SSM.Region), func(o *ssm.Options) {
+		o.Retryer = throttlingRetryer()
+	}))
+}
+
+// throttlingRetryer retries throttled AWS calls longer than the SDK default, as CI jobs deploying
+// at the same time share the API rate limits of the account
+func throttlingRetryer() aws.Retryer {
+	return retry.AddWithMaxBackoffDelay(retry.AddWithMaxAttempts(retry.NewStandard(), 10), 20*time.Second)
+}
+
+func withRegion(awsConfig aws.Config, region string) aws.Config {
+	if region == "" {
+		return awsConfig
+	}
+
+	cfg := awsConfig.Copy()
+	cfg.Region = region
+
+	return cfg
+}
+
+// Provider returns the provider of the scheme of val, false when val is not a secret reference
+func (r *Resolver) Provider(val string) (SecretProvider, string, bool) {
+	scheme, ref, ok := strings.Cut(val, ":")
+	if !ok {
+		return nil, "", false
+	}
+
+	provider, ok := r.providers[scheme]
+	return provider, ref, ok
+}
+
+// GetSecret resolves a secret reference, replacing the {environment} placeholder with environment
+func (r *Resolver) GetSecret(ctx context.Context, secretRef string, environment string) (string, error) {
+	provider, ref, ok := r.Provider(secretRef)
+	if !ok {
+		return "", fmt.Errorf("invalid secret reference format: %s", secretRef)
+	}
+
+	return provider.GetSecret(ctx, strings.ReplaceAll(ref, "{environment}", environment))
+}
+
+// ProcessSecretRefs resolves secret references in environment variables, other values are kept as is.
+// References are resolved concurrently, in batches where the provider supports it, and every
+// variable that cannot be resolved is reported in the error.
+func (r *Resolver) ProcessSecretRefs(ctx context.Context, env map[string]string, environment string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	// the references of each provider, and the variables using each reference
+	refs := make(map[SecretProvider][]string)
+	users := make(map[SecretProvider]map[string][]string)
+	for key, val := range env {
+		provider, ref, ok := r.Provider(val)
+		if !ok {
+			result[key] = val
+			continue
+		}
+
+		ref = strings.ReplaceAll(ref, "{environment}", environment)
+		if users[provider] == nil {
+			users[provider] = make(map[string][]string)
+		}
+		if len(users[provider][ref]) == 0 {
+			refs[provider] = append(refs[provider], ref)
+		}
+		users[provider][ref] = append(users[provider][ref], key)
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed []string
+		errs   []error
+	)
+	for provider, providerRefs := range refs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			values, err := resolve(ctx, provider, providerRefs)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, ref := range providerRefs {
+				value, ok := values[ref]
+				for _, key := range users[provider][ref] {
+					if ok {
+						result[key] = value
+					} else {
+						failed = append(failed, key)
+					}
+				}
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		if err == nil {
+			return nil, fmt.Errorf("failed to resolve secrets for %s", strings.Join(failed, ", "))
+		}
+
+		return nil, fmt.Errorf("failed to resolve secrets for %s: %w", strings.Join(failed, ", "), err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	return result, nil
+}
+
+// References returns the variables of env that are secret references
+func (r *Resolver) References(env map[string]string) map[string]string {
+	refs := make(map[string]string)
+	for key, val := range env {
+		if _, _, ok := r.Provider(val); ok {
+			refs[key] = val
+		}
+	}
+
+	return refs
+}
+
+// Hash returns a digest of the variables of values, to tell whether secrets changed without
+// keeping their values
+func Hash(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%d:%s=%d:%s\n", len(key), key, len(values[key]), values[key])
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// resolve returns the values of refs from provider, in one batch when it supports it and with
+// up to maxParallelLookups lookups at a time otherwise
+func resolve(ctx context.Context, provider SecretProvider, refs []string) (map[string]string, error) {
+	if batch, ok := provider.(BatchProvider); ok {
+		return batch.GetSecrets(ctx, refs)
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		values = make(map[string]string)
+		errs   []error
+		sem    = make(chan struct{}, maxParallelLookups)
+	)
+	for _, ref := range refs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			value, err := provider.GetSecret(ctx, ref)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+				return
+			}
+			values[ref] = value
+		}()
+	}
+	wg.Wait()
+
+	return values, errors.Join(errs...)
+}
+
+// splitKey splits ref#key, key selects a field of a structured secret
+func splitKey(ref string) (string, string) {
+	ref, key, _ := strings.Cut(ref, "#")
+	return ref, key
+}
@@ -0,0 +1,134 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// SecretsManager retrieves secrets from AWS Secrets Manager
+type SecretsManager struct {
+	client *secretsmanager.Client
+}
+
+// NewSecretsManager creates a new AWS Secrets Manager provider
+func NewSecretsManager(client *secretsmanager.Client) *SecretsManager {
+	return &SecretsManager{client: client}
+}
+
+// GetSecret retrieves the secret ref, an ARN or a name. With ref#key, the secret is a JSON
+// object and the value of key is returned.
+func (m *SecretsManager) GetSecret(ctx context.Context, ref string) (string, error) {
+	id, key := splitKey(ref)
+
+	value, err := m.getSecretValue(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	if key == "" {
+		return value, nil
+	}
+
+	return jsonField(value, key)
+}
+
+// GetSecrets retrieves each secret of refs once, however many #keys of it are referenced, with
+// up to maxParallelLookups lookups at a time
+func (m *SecretsManager) GetSecrets(ctx context.Context, refs []string) (map[string]string, error) {
+	keys := make(map[string][]string)
+	for _, ref := range refs {
+		id, _ := splitKey(ref)
+		keys[id] = append(keys[id], ref)
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		values = make(map[string]string)
+		errs   []error
+		sem    = make(chan struct{}, maxParallelLookups)
+	)
+	for id, idRefs := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			value, err := m.getSecretValue(ctx, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", id, err))
+				return
+			}
+
+			for _, ref := range idRefs {
+				_, key := splitKey(ref)
+				if key == "" {
+					values[ref] = value
+					continue
+				}
+
+				field, err := jsonField(value, key)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+					continue
+				}
+				values[ref] = field
+			}
+		}()
+	}
+	wg.Wait()
+
+	return values, errors.Join(errs...)
+}
+
+// getSecretValue returns the current value of the secret id, as a string
+func (m *SecretsManager) getSecretValue(ctx context.Context, id string) (string, error) {
+	out, err := m.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret from Secrets Manager: %w", err)
+	}
+
+	if out.SecretString == nil {
+		return string(out.SecretBinary), nil
+	}
+
+	return aws.ToString(out.SecretString), nil
+}
+
+// jsonField returns the field key of a JSON object, values other than strings are returned as JSON
+func jsonField(value, key string) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, remove #%s to use the whole value", key)
+	}
+
+	field, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no key %q", key)
+	}
+
+	var s string
+	if err := json.Unmarshal(field, &s); err == nil {
+		return s, nil
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, field); err != nil {
+		return "", err
+	}
+
+	return compact.String(), nil
+}
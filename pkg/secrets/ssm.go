@@ -2,15 +2,67 @@ package secrets
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
 )
 
+const (
+	// ssmBatchSize is the most names GetParameters accepts
+	ssmBatchSize = 10
+	// ssmParallelBatches bounds the concurrent GetParameters calls, to stay below the rate limit
+	ssmParallelBatches = 4
+)
+
+// SecretPath returns the parameter name of the secret name of app in environment,
+// /<app>/<environment>/<name>
+func SecretPath(app, environment, name string) string {
+	return fmt.Sprintf("/%s/%s/%s", app, environment, name)
+}
+
+// SecretRef returns the reference to the secret name of app in env, resolved to the
+// parameter of the environment being deployed
+func SecretRef(app, name string) string {
+	return SchemeSecret + ":" + SecretPath(app, "{environment}", name)
+}
+
+// SSMParameter returns the parameter name val refers to in environment, false when val is not
+// a Parameter Store reference
+func SSMParameter(val, environment string) (string, bool) {
+	scheme, ref, ok := strings.Cut(val, ":")
+	if !ok || (scheme != SchemeSSM && scheme != SchemeSecret) {
+		return "", false
+	}
+
+	return strings.ReplaceAll(ref, "{environment}", environment), true
+}
+
+// Parameter is a parameter listed from Parameter Store
+type Parameter struct {
+	Name         string
+	Value        string
+	Version      int64
+	LastModified time.Time
+}
+
+// ssmAPI is the part of the SSM client the manager uses
+type ssmAPI interface {
+	ssm.GetParametersByPathAPIClient
+	GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+	DeleteParameter(ctx context.Context, params *ssm.DeleteParameterInput, optFns ...func(*ssm.Options)) (*ssm.DeleteParameterOutput, error)
+}
+
 // SSMManager handles retrieving secrets from AWS Systems Manager Parameter Store
 type SSMManager struct {
-	ssmClient *ssm.Client
+	ssmClient ssmAPI
 }
 
 // NewSSMManager creates a new AWS SSM Parameter Store manager
@@ -20,52 +72,140 @@ func NewSSMManager(client *ssm.Client) (*SSMManager, error) {
 	}, nil
 }
 
-// GetSecret retrieves a secret from SSM Parameter Store
-func (m *SSMManager) GetSecret(secretRef string, environment string) (string, error) {
-	ctx := context.Background()
-
-	// Parse secret reference, expected format: secret:/app-name/{environment}/SECRET_NAME
-	if !strings.HasPrefix(secretRef, "secret:") {
-		return "", fmt.Errorf("invalid secret reference format: %s", secretRef)
+// GetSecret retrieves a secret from SSM Parameter Store, paramPath is the parameter name
+// such as /app-name/prod/SECRET_NAME
+func (m *SSMManager) GetSecret(ctx context.Context, paramPath string) (string, error) {
+	values, err := m.GetSecrets(ctx, []string{paramPath})
+	if err != nil {
+		return "", err
 	}
 
-	// Extract parameter path
-	paramPath := strings.TrimPrefix(secretRef, "secret:")
+	return values[paramPath], nil
+}
 
-	// Replace {environment} placeholder with actual environment name
-	paramPath = strings.ReplaceAll(paramPath, "{environment}", environment)
+// GetSecrets retrieves parameters with GetParameters, in batches of 10 fetched concurrently.
+// Parameters are requested by name or ARN, optionally with a :version or :label selector, and
+// returned under the reference they were requested with. The error lists every parameter that
+// does not exist.
+func (m *SSMManager) GetSecrets(ctx context.Context, paramPaths []string) (map[string]string, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		values  = make(map[string]string)
+		missing []string
+		errs    []error
+		sem     = make(chan struct{}, ssmParallelBatches)
+	)
 
-	// Create pointer to boolean for WithDecryption field
-	decrypt := true
+	for start := 0; start < len(paramPaths); start += ssmBatchSize {
+		batch := paramPaths[start:min(start+ssmBatchSize, len(paramPaths))]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			out, err := m.ssmClient.GetParameters(ctx, &ssm.GetParametersInput{
+				Names:          batch,
+				WithDecryption: aws.Bool(true),
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get parameters from SSM: %w", err))
+				return
+			}
 
-	// Get parameter from SSM
-	param, err := m.ssmClient.GetParameter(ctx, &ssm.GetParameterInput{
-		Name:           &paramPath,
-		WithDecryption: &decrypt,
+			// parameters are returned by name whether they were requested by name or ARN, with
+			// the selector of /app/KEY:3 apart
+			returned := make(map[string]string, 2*len(out.Parameters))
+			for _, param := range out.Parameters {
+				selector := aws.ToString(param.Selector)
+				returned[aws.ToString(param.Name)+selector] = aws.ToString(param.Value)
+				returned[aws.ToString(param.ARN)+selector] = aws.ToString(param.Value)
+			}
+
+			for _, name := range batch {
+				if value, ok := returned[name]; ok {
+					values[name] = value
+				} else {
+					missing = append(missing, name)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		errs = append(errs, fmt.Errorf("SSM parameters not found: %s", strings.Join(missing, ", ")))
+	}
+
+	return values, errors.Join(errs...)
+}
+
+// PutSecret writes value to the SecureString parameter name, replacing its current value
+func (m *SSMManager) PutSecret(ctx context.Context, name, value string) (int64, error) {
+	out, err := m.ssmClient.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(value),
+		Type:      types.ParameterTypeSecureString,
+		Overwrite: aws.Bool(true),
 	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to put parameter %s: %w", name, err)
+	}
 
+	return out.Version, nil
+}
+
+// DeleteSecret deletes the parameter name
+func (m *SSMManager) DeleteSecret(ctx context.Context, name string) error {
+	_, err := m.ssmClient.DeleteParameter(ctx, &ssm.DeleteParameterInput{Name: aws.String(name)})
+
+	var notFound *types.ParameterNotFound
+	if errors.As(err, &notFound) {
+		return fmt.Errorf("SSM parameter not found: %s", name)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to get parameter from SSM: %w", err)
+		return fmt.Errorf("failed to delete parameter %s: %w", name, err)
 	}
 
-	return *param.Parameter.Value, nil
+	return nil
 }
 
-// ProcessSecretRefs resolves secret references in environment variables
-func (m *SSMManager) ProcessSecretRefs(env map[string]string, environment string) (map[string]string, error) {
-	result := make(map[string]string)
+// ListSecrets returns the parameters under path sorted by name, in sub-paths too when recursive.
+// Values are only read with decrypt.
+func (m *SSMManager) ListSecrets(ctx context.Context, path string, recursive, decrypt bool) ([]Parameter, error) {
+	var params []Parameter
 
-	for key, val := range env {
-		if strings.HasPrefix(val, "secret:") {
-			secretVal, err := m.GetSecret(val, environment)
-			if err != nil {
-				return nil, fmt.Errorf("failed to resolve secret for %s: %w", key, err)
+	paginator := ssm.NewGetParametersByPathPaginator(m.ssmClient, &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(recursive),
+		WithDecryption: aws.Bool(decrypt),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parameters under %s: %w", path, err)
+		}
+
+		for _, param := range page.Parameters {
+			p := Parameter{
+				Name:         aws.ToString(param.Name),
+				Version:      param.Version,
+				LastModified: aws.ToTime(param.LastModifiedDate),
 			}
-			result[key] = secretVal
-		} else {
-			result[key] = val
+			if decrypt {
+				p.Value = aws.ToString(param.Value)
+			}
+			params = append(params, p)
 		}
 	}
 
-	return result, nil
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+
+	return params, nil
 }
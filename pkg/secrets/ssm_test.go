@@ -0,0 +1,168 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const testARNPrefix = "arn:aws:ssm:us-east-1:123456789012:parameter"
+
+// fakeSSM answers GetParameters like Parameter Store: parameters come back under their name and
+// ARN, with the selector they were requested with, and unknown names are listed as invalid
+type fakeSSM struct {
+	ssmAPI
+
+	values map[string]string
+	fail   string
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (f *fakeSSM) GetParameters(ctx context.Context, in *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	f.mu.Lock()
+	f.batches = append(f.batches, in.Names)
+	f.mu.Unlock()
+
+	if len(in.Names) > ssmBatchSize {
+		return nil, fmt.Errorf("%d names requested, at most %d are accepted", len(in.Names), ssmBatchSize)
+	}
+
+	out := &ssm.GetParametersOutput{}
+	for _, ref := range in.Names {
+		if ref == f.fail {
+			return nil, errors.New("throttled")
+		}
+
+		name := strings.TrimPrefix(ref, testARNPrefix)
+		var selector *string
+		if i := strings.LastIndex(name, ":"); i >= 0 {
+			selector = aws.String(name[i:])
+			name = name[:i]
+		}
+
+		value, ok := f.values[name]
+		if !ok {
+			out.InvalidParameters = append(out.InvalidParameters, ref)
+			continue
+		}
+
+		out.Parameters = append(out.Parameters, types.Parameter{
+			Name:     aws.String(name),
+			ARN:      aws.String(testARNPrefix + name),
+			Selector: selector,
+			Value:    aws.String(value),
+		})
+	}
+
+	return out, nil
+}
+
+func TestSSMGetSecrets(t *testing.T) {
+	values := map[string]string{
+		"/app/prod/DATABASE_URL": "postgres://db",
+		"/app/prod/API_TOKEN":    "token",
+	}
+
+	var many []string
+	manyWant := make(map[string]string)
+	for i := 0; i < 25; i++ {
+		name := fmt.Sprintf("/app/prod/KEY_%02d", i)
+		values[name] = fmt.Sprintf("value-%d", i)
+		many = append(many, name)
+		manyWant[name] = values[name]
+	}
+
+	firstTen := many[:10:10]
+	firstTenWant := make(map[string]string)
+	for _, name := range firstTen {
+		firstTenWant[name] = values[name]
+	}
+	withToken := maps.Clone(firstTenWant)
+	withToken["/app/prod/API_TOKEN"] = "token"
+
+	tests := []struct {
+		name    string
+		refs    []string
+		fail    string
+		want    map[string]string
+		batches int
+		err     string
+	}{
+		{
+			name:    "by name",
+			refs:    []string{"/app/prod/DATABASE_URL", "/app/prod/API_TOKEN"},
+			want:    map[string]string{"/app/prod/DATABASE_URL": "postgres://db", "/app/prod/API_TOKEN": "token"},
+			batches: 1,
+		},
+		{
+			name:    "by ARN",
+			refs:    []string{testARNPrefix + "/app/prod/API_TOKEN"},
+			want:    map[string]string{testARNPrefix + "/app/prod/API_TOKEN": "token"},
+			batches: 1,
+		},
+		{
+			name: "with selectors",
+			refs: []string{"/app/prod/API_TOKEN:3", "/app/prod/API_TOKEN:live", testARNPrefix + "/app/prod/DATABASE_URL:2"},
+			want: map[string]string{
+				"/app/prod/API_TOKEN:3":                    "token",
+				"/app/prod/API_TOKEN:live":                 "token",
+				testARNPrefix + "/app/prod/DATABASE_URL:2": "postgres://db",
+			},
+			batches: 1,
+		},
+		{
+			name:    "batches of ten",
+			refs:    many,
+			want:    manyWant,
+			batches: 3,
+		},
+		{
+			name:    "missing parameters are reported together",
+			refs:    append(append([]string{"/app/prod/NOPE", "/app/prod/API_TOKEN"}, firstTen...), "/app/prod/ALSO_NOPE"),
+			want:    withToken,
+			batches: 2,
+			err:     "SSM parameters not found: /app/prod/ALSO_NOPE, /app/prod/NOPE",
+		},
+		{
+			name:    "failed batch keeps the values of the others",
+			refs:    append(firstTen, "/app/prod/API_TOKEN"),
+			fail:    "/app/prod/API_TOKEN",
+			want:    firstTenWant,
+			batches: 2,
+			err:     "failed to get parameters from SSM: throttled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeSSM{values: values, fail: tt.fail}
+			m := &SSMManager{ssmClient: client}
+
+			got, err := m.GetSecrets(context.Background(), tt.refs)
+			if tt.err == "" && err != nil {
+				t.Fatalf("GetSecrets() error = %v", err)
+			}
+			if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("GetSecrets() error = %v, want %q", err, tt.err)
+			}
+
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("GetSecrets() = %v, want %v", got, tt.want)
+			}
+
+			if len(client.batches) != tt.batches {
+				t.Errorf("GetParameters called %d times, want %d", len(client.batches), tt.batches)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+)
+
+// Vault retrieves secrets from a HashiCorp Vault KV secrets engine
+type Vault struct {
+	config config.VaultConfig
+	client *http.Client
+}
+
+// NewVault creates a new Vault KV provider
+func NewVault(cfg config.VaultConfig) *Vault {
+	return &Vault{
+		config: cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// GetSecret retrieves key of the secret at ref, <mount>/<path>#<key> such as kv/app-name/prod#DATABASE_URL
+func (v *Vault) GetSecret(ctx context.Context, ref string) (string, error) {
+	ref, key := splitKey(ref)
+	mount, path, ok := strings.Cut(strings.Trim(ref, "/"), "/")
+	if !ok || key == "" {
+		return "", fmt.Errorf("invalid vault reference %q, use vault:<mount>/<path>#<key>", ref)
+	}
+
+	if v.config.Address == "" {
+		return "", fmt.Errorf("vault address is not set, set secrets.vault.address or VAULT_ADDR")
+	}
+
+	token, err := vaultToken()
+	if err != nil {
+		return "", err
+	}
+
+	secretURL := fmt.Sprintf("%s/v1/%s/%s", strings.TrimSuffix(v.config.Address, "/"), url.PathEscape(mount), path)
+	if v.config.KVVersion == 2 {
+		secretURL = fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(v.config.Address, "/"), url.PathEscape(mount), path)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, secretURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret from vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get secret %s from vault: %s", ref, resp.Status)
+	}
+
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	data := body.Data
+	if v.config.KVVersion == 2 {
+		// KV v2 nests the secret next to its metadata
+		var versioned struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &versioned); err != nil {
+			return "", fmt.Errorf("failed to decode vault response: %w", err)
+		}
+		data = versioned.Data
+	}
+
+	return jsonField(string(data), key)
+}
+
+// vaultToken returns VAULT_TOKEN or the token stored by vault login
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+	if err != nil {
+		return "", fmt.Errorf("vault token not found, set VAULT_TOKEN or run vault login")
+	}
+
+	return strings.TrimSpace(string(token)), nil
+}
@@ -0,0 +1,174 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// buildkitMetadataKey holds BuildKit specific metadata in SLSA v0.2 provenance, such as the git revision
+const buildkitMetadataKey = "https://mobyproject.org/buildkit@v1#metadata"
+
+// Attestations are the SBOM and provenance BuildKit attached to an image
+type Attestations struct {
+	Image string
+	// SBOM is the SPDX document of the image
+	SBOM json.RawMessage
+	// Provenance is the SLSA provenance predicate of the build
+	Provenance json.RawMessage
+}
+
+// Provenance is the part of a SLSA provenance predicate shown by fyve image inspect
+type Provenance struct {
+	BuilderID  string
+	Revision   string
+	Source     string
+	StartedOn  string
+	FinishedOn string
+	// Args are the build parameters, build-arg:<name> and label:<name> among them
+	Args map[string]string
+}
+
+// InspectAttestations reads the attestations of image from its registry with docker buildx imagetools
+func InspectAttestations(ctx context.Context, image string) (*Attestations, error) {
+	sbom, err := imagetoolsInspect(ctx, image, "{{json .SBOM}}", "SPDX")
+	if err != nil {
+		return nil, err
+	}
+
+	provenance, err := imagetoolsInspect(ctx, image, "{{json .Provenance}}", "SLSA")
+	if err != nil {
+		return nil, err
+	}
+
+	if sbom == nil && provenance == nil {
+		return nil, fmt.Errorf("%s has no attestations, build it with security.attestations enabled", image)
+	}
+
+	return &Attestations{Image: image, SBOM: sbom, Provenance: provenance}, nil
+}
+
+// imagetoolsInspect returns the document under key, of the first platform for multi-platform images
+func imagetoolsInspect(ctx context.Context, image, format, key string) (json.RawMessage, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", "buildx", "imagetools", "inspect", image, "--format", format)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("inspect %s: %w: %s", image, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var docs map[string]json.RawMessage
+	if err := json.Unmarshal(bytes.TrimSpace(out), &docs); err != nil || len(docs) == 0 {
+		return nil, nil
+	}
+
+	if doc, ok := docs[key]; ok {
+		return doc, nil
+	}
+
+	platforms := make([]string, 0, len(docs))
+	for platform := range docs {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	var platformDocs map[string]json.RawMessage
+	if err := json.Unmarshal(docs[platforms[0]], &platformDocs); err != nil {
+		return nil, nil
+	}
+
+	return platformDocs[key], nil
+}
+
+// SBOMPackages returns the number of packages in the SBOM
+func (a *Attestations) SBOMPackages() int {
+	var spdx struct {
+		Packages []json.RawMessage `json:"packages"`
+	}
+	_ = json.Unmarshal(a.SBOM, &spdx)
+
+	return len(spdx.Packages)
+}
+
+// ParseProvenance reads SLSA v0.2 provenance, as BuildKit writes by default, and SLSA v1
+func (a *Attestations) ParseProvenance() (Provenance, error) {
+	var predicate struct {
+		// SLSA v0.2
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Invocation struct {
+			Parameters struct {
+				Args map[string]string `json:"args"`
+			} `json:"parameters"`
+		} `json:"invocation"`
+		Metadata map[string]json.RawMessage `json:"metadata"`
+
+		// SLSA v1
+		BuildDefinition struct {
+			ExternalParameters struct {
+				Request struct {
+					Args map[string]string `json:"args"`
+				} `json:"request"`
+			} `json:"externalParameters"`
+			InternalParameters struct {
+				Buildkit struct {
+					VCS map[string]string `json:"vcs"`
+				} `json:"buildkit_metadata"`
+			} `json:"internalParameters"`
+		} `json:"buildDefinition"`
+		RunDetails struct {
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+			Metadata struct {
+				StartedOn  string `json:"startedOn"`
+				FinishedOn string `json:"finishedOn"`
+			} `json:"metadata"`
+		} `json:"runDetails"`
+	}
+
+	if err := json.Unmarshal(a.Provenance, &predicate); err != nil {
+		return Provenance{}, fmt.Errorf("parse provenance: %w", err)
+	}
+
+	p := Provenance{
+		BuilderID:  predicate.Builder.ID,
+		Args:       predicate.Invocation.Parameters.Args,
+		StartedOn:  metadataString(predicate.Metadata, "buildStartedOn"),
+		FinishedOn: metadataString(predicate.Metadata, "buildFinishedOn"),
+	}
+
+	vcs := predicate.BuildDefinition.InternalParameters.Buildkit.VCS
+	if raw, ok := predicate.Metadata[buildkitMetadataKey]; ok {
+		var buildkit struct {
+			VCS map[string]string `json:"vcs"`
+		}
+		_ = json.Unmarshal(raw, &buildkit)
+		vcs = buildkit.VCS
+	}
+	p.Revision = vcs["revision"]
+	p.Source = vcs["source"]
+
+	if p.BuilderID == "" {
+		p.BuilderID = predicate.RunDetails.Builder.ID
+		p.Args = predicate.BuildDefinition.ExternalParameters.Request.Args
+		p.StartedOn = predicate.RunDetails.Metadata.StartedOn
+		p.FinishedOn = predicate.RunDetails.Metadata.FinishedOn
+	}
+
+	return p, nil
+}
+
+func metadataString(metadata map[string]json.RawMessage, key string) string {
+	var s string
+	_ = json.Unmarshal(metadata[key], &s)
+
+	return s
+}
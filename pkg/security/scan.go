@@ -0,0 +1,145 @@
+package security
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	"github.com/fyve-labs/fyve-cli/pkg/registry"
+)
+
+// ScanResult is the outcome of the scan gate for an image
+type ScanResult struct {
+	Image     string
+	Threshold string
+	// Counts are the number of findings by severity, allowlisted ones included
+	Counts map[string]int
+	// Blocking are the findings at or above the threshold that are not allowlisted
+	Blocking []registry.Finding
+	// Allowed are the findings at or above the threshold that are allowlisted
+	Allowed []registry.Finding
+}
+
+// Failed reports whether the image has blocking findings
+func (r ScanResult) Failed() bool {
+	return len(r.Blocking) > 0
+}
+
+// LoadAllowlist reads vulnerability IDs from path, one per line. Text after # is a comment,
+// such as the reason the vulnerability is accepted. An empty path allows nothing.
+func LoadAllowlist(path string) (map[string]bool, error) {
+	allowed := make(map[string]bool)
+	if path == "" {
+		return allowed, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scan allowlist: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if id := strings.TrimSpace(line); id != "" {
+			allowed[strings.ToUpper(id)] = true
+		}
+	}
+
+	return allowed, scanner.Err()
+}
+
+// EvaluateScan compares the findings of image with the threshold severity and the allowlist
+func EvaluateScan(image string, findings []registry.Finding, threshold string, allowlist map[string]bool) ScanResult {
+	result := ScanResult{
+		Image:     image,
+		Threshold: threshold,
+		Counts:    make(map[string]int),
+	}
+
+	minRank := severityRank(threshold)
+	for _, f := range findings {
+		result.Counts[f.Severity]++
+		if severityRank(f.Severity) < minRank {
+			continue
+		}
+
+		if allowlist[strings.ToUpper(f.ID)] {
+			result.Allowed = append(result.Allowed, f)
+		} else {
+			result.Blocking = append(result.Blocking, f)
+		}
+	}
+
+	sort.SliceStable(result.Blocking, func(i, j int) bool {
+		return severityRank(result.Blocking[i].Severity) > severityRank(result.Blocking[j].Severity)
+	})
+
+	return result
+}
+
+// severityRank orders severities, unknown ones such as UNTRIAGED rank below INFORMATIONAL
+func severityRank(severity string) int {
+	return slices.Index(config.ScanSeverities, strings.ToUpper(severity))
+}
+
+// Summary returns the findings as Markdown, readable in a terminal and as a GitHub step summary
+func (r ScanResult) Summary() string {
+	var b strings.Builder
+
+	status := "passed"
+	if r.Failed() {
+		status = "failed"
+	}
+	fmt.Fprintf(&b, "### Vulnerability scan of `%s` %s\n\n", r.Image, status)
+
+	b.WriteString("| Severity | Findings |\n|---|---|\n")
+	for i := len(config.ScanSeverities) - 1; i >= 0; i-- {
+		severity := config.ScanSeverities[i]
+		fmt.Fprintf(&b, "| %s | %d |\n", severity, r.Counts[severity])
+	}
+	fmt.Fprintf(&b, "\nFindings of severity %s or higher fail the deploy.\n", r.Threshold)
+
+	if len(r.Blocking) > 0 {
+		b.WriteString("\n| Vulnerability | Severity | Package |\n|---|---|---|\n")
+		for _, f := range r.Blocking {
+			id := f.ID
+			if f.URI != "" {
+				id = fmt.Sprintf("[%s](%s)", f.ID, f.URI)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", id, f.Severity, f.Package)
+		}
+	}
+
+	if len(r.Allowed) > 0 {
+		ids := make([]string, 0, len(r.Allowed))
+		for _, f := range r.Allowed {
+			ids = append(ids, f.ID)
+		}
+		fmt.Fprintf(&b, "\nAllowlisted: %s\n", strings.Join(ids, ", "))
+	}
+
+	return b.String()
+}
+
+// WriteStepSummary appends markdown to the job summary when running in GitHub Actions
+func WriteStepSummary(markdown string) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write step summary: %w", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, markdown)
+	return err
+}
@@ -0,0 +1,81 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SignImage signs image, a reference pinned to a digest, with key using the cosign CLI. The
+// signature is stored in the registry as <repository>:sha256-<digest>.sig, the sigstore layout,
+// and is not uploaded to the public Rekor transparency log, which would publish the image names.
+// KMS keys use the AWS credentials of the environment, region is used when AWS_REGION is not set.
+func SignImage(ctx context.Context, image, key, region string) error {
+	if !strings.Contains(image, "@sha256:") {
+		return fmt.Errorf("sign %s: the image must be pinned to a digest", image)
+	}
+
+	fmt.Printf("Signing %s...\n", image)
+	_, err := cosign(ctx, region, "sign", "--yes", "--key", key, "--tlog-upload=false", image)
+	if err != nil {
+		return fmt.Errorf("sign %s: %w", image, err)
+	}
+
+	return nil
+}
+
+// VerifyImageSignature checks that image, pinned to a digest, is signed by one of keys. Images are
+// signed without the transparency log, so it is not checked either (--insecure-ignore-tlog).
+func VerifyImageSignature(ctx context.Context, image string, keys []string, region string) error {
+	if !strings.Contains(image, "@sha256:") {
+		return fmt.Errorf("verify %s: the image must be pinned to a digest", image)
+	}
+
+	var errs []error
+	for _, key := range keys {
+		_, err := cosign(ctx, region, "verify", "--key", key, "--insecure-ignore-tlog=true", image)
+		if err == nil {
+			fmt.Printf("Verified signature of %s with %s\n", image, key)
+			return nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", key, err))
+	}
+
+	return fmt.Errorf("%s is not signed by a trusted key: %w", image, errors.Join(errs...))
+}
+
+// RequireCosign fails when the cosign CLI is not installed, deploys check it before pushing images
+// they would not be able to sign
+func RequireCosign() error {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return fmt.Errorf("cosign is required to sign and verify images, see https://docs.sigstore.dev/cosign/system_config/installation/")
+	}
+
+	return nil
+}
+
+func cosign(ctx context.Context, region string, args ...string) ([]byte, error) {
+	if err := RequireCosign(); err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "cosign", args...)
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+	if os.Getenv("AWS_REGION") == "" && region != "" {
+		cmd.Env = append(cmd.Env, "AWS_REGION="+region)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
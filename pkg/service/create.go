@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/fyve-labs/fyve-cli/pkg/config"
 	"io"
@@ -17,6 +18,18 @@ import (
 	"time"
 )
 
+const (
+	// ImageAnnotationKey holds the human-readable image reference of a revision pinned to a digest
+	ImageAnnotationKey = "fyve.dev/image"
+	// SecretRefsAnnotationKey holds the secret references the env of a revision was resolved from, as JSON
+	SecretRefsAnnotationKey = "fyve.dev/secret-refs"
+	// SecretsSourceAnnotationKey holds the environment and the backends the secrets of a revision
+	// were resolved with, as JSON
+	SecretsSourceAnnotationKey = "fyve.dev/secrets-source"
+	// SecretsHashAnnotationKey holds the digest of the secret values of a revision
+	SecretsHashAnnotationKey = "fyve.dev/secrets-hash"
+)
+
 func CreateService(ctx context.Context, client clientservingv1.KnServingClient, namespace string, appConfig *config.AppConfig, env map[string]string, forceCreate bool, out io.Writer) error {
 	service := &servingv1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -34,6 +47,24 @@ func CreateService(ctx context.Context, client clientservingv1.KnServingClient,
 		},
 	}
 
+	if appConfig.ImageTag != "" {
+		service.Spec.Template.Annotations[ImageAnnotationKey] = appConfig.ImageTag
+	}
+
+	if appConfig.SecretsHash != "" {
+		refs, err := json.Marshal(appConfig.SecretRefs)
+		if err != nil {
+			return err
+		}
+		source, err := json.Marshal(appConfig.SecretsSource)
+		if err != nil {
+			return err
+		}
+		service.Spec.Template.Annotations[SecretRefsAnnotationKey] = string(refs)
+		service.Spec.Template.Annotations[SecretsSourceAnnotationKey] = string(source)
+		service.Spec.Template.Annotations[SecretsHashAnnotationKey] = appConfig.SecretsHash
+	}
+
 	service.Spec.Template.Spec.Containers = []corev1.Container{{
 		Image: appConfig.Image,
 		Env:   envMapToEnvvar(env),
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fyve-labs/fyve-cli/pkg/config"
+	kconfig "knative.dev/client/pkg/config"
+	clientservingv1 "knative.dev/client/pkg/serving/v1"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+// DeployedSecrets returns the secret references the revision template of service was deployed
+// with, what they were resolved with and the digest of their values, nil when fyve deploy
+// recorded no secrets
+func DeployedSecrets(service *servingv1.Service) (*DeployedSecretRefs, error) {
+	annotations := service.Spec.Template.Annotations
+	hash := annotations[SecretsHashAnnotationKey]
+	if hash == "" {
+		return nil, nil
+	}
+
+	deployed := &DeployedSecretRefs{Hash: hash}
+	if err := json.Unmarshal([]byte(annotations[SecretRefsAnnotationKey]), &deployed.Refs); err != nil {
+		return nil, fmt.Errorf("service '%s': invalid %s annotation: %w", service.Name, SecretRefsAnnotationKey, err)
+	}
+
+	if err := json.Unmarshal([]byte(annotations[SecretsSourceAnnotationKey]), &deployed.Source); err != nil {
+		return nil, fmt.Errorf("service '%s': invalid %s annotation, redeploy it with fyve deploy: %w", service.Name, SecretsSourceAnnotationKey, err)
+	}
+
+	return deployed, nil
+}
+
+// DeployedSecretRefs are the secrets recorded on a revision by fyve deploy
+type DeployedSecretRefs struct {
+	Refs   map[string]string
+	Source config.SecretsSource
+	Hash   string
+}
+
+// UpdateSecrets sets the variables of env in the container of the service and records hash,
+// which rolls a new revision, and waits for it to become ready
+func UpdateSecrets(ctx context.Context, client clientservingv1.KnServingClient, name string, env map[string]string, hash string, out io.Writer) error {
+	updateFunc := func(service *servingv1.Service) (*servingv1.Service, error) {
+		if len(service.Spec.Template.Spec.Containers) == 0 {
+			return nil, fmt.Errorf("service '%s' has no container", name)
+		}
+
+		container := &service.Spec.Template.Spec.Containers[0]
+		for i := range container.Env {
+			if value, ok := env[container.Env[i].Name]; ok {
+				container.Env[i].Value = value
+			}
+		}
+
+		if service.Spec.Template.Annotations == nil {
+			service.Spec.Template.Annotations = map[string]string{}
+		}
+		service.Spec.Template.Annotations[SecretsHashAnnotationKey] = hash
+
+		return service, nil
+	}
+
+	if _, err := client.UpdateServiceWithRetry(ctx, name, updateFunc, kconfig.DefaultRetry.Steps); err != nil {
+		return err
+	}
+
+	return waitIfRequested(ctx, client, name, "Updating", "updated", out)
+}
@@ -0,0 +1,107 @@
+package socketproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"tailscale.com/client/local"
+	"tailscale.com/ipn"
+)
+
+// HealthCheck reports an error when a dependency of the proxy is unavailable
+type HealthCheck func(ctx context.Context) error
+
+// SocketHealthCheck pings the Docker daemon over the socket at socketPath
+func SocketHealthCheck(socketPath string) HealthCheck {
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/_ping", nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("docker socket: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("docker socket: ping returned %s", resp.Status)
+		}
+
+		return nil
+	}
+}
+
+// TailnetHealthCheck requires the tsnet node to be running
+func TailnetHealthCheck(lc *local.Client) HealthCheck {
+	return func(ctx context.Context) error {
+		state, err := TailnetState(ctx, lc)
+		if err != nil {
+			return err
+		}
+
+		if state != ipn.Running.String() {
+			return fmt.Errorf("tailnet: node is %s", state)
+		}
+
+		return nil
+	}
+}
+
+// TailnetState returns the backend state of the tsnet node, such as Running or NeedsLogin
+func TailnetState(ctx context.Context, lc *local.Client) (string, error) {
+	status, err := lc.StatusWithoutPeers(ctx)
+	if err != nil {
+		return "", fmt.Errorf("tailnet: %w", err)
+	}
+
+	return status.BackendState, nil
+}
+
+// TailnetMetrics writes the tsnet connection state as a gauge set to 1 for the current state
+func TailnetMetrics(lc *local.Client) func(w io.Writer) {
+	return func(w io.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		state, err := TailnetState(ctx, lc)
+		if err != nil {
+			state = "Unknown"
+		}
+
+		fmt.Fprintln(w, "# HELP socket_proxy_tailnet_state Connection state of the tsnet node.")
+		fmt.Fprintln(w, "# TYPE socket_proxy_tailnet_state gauge")
+		fmt.Fprintf(w, "socket_proxy_tailnet_state{state=%q} 1\n", state)
+	}
+}
+
+// HealthHandler answers 200 when all checks pass and 503 with the first failure otherwise
+func HealthHandler(checks ...HealthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		for _, check := range checks {
+			if err := check(ctx); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		_, _ = io.WriteString(w, "ok\n")
+	})
+}
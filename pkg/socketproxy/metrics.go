@@ -0,0 +1,218 @@
+package socketproxy
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the request duration histogram
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+const (
+	// ConnectionHijacked counts upgraded connections, used by attach and exec
+	ConnectionHijacked = "hijacked"
+	// ConnectionStream counts streamed responses, such as followed logs and events
+	ConnectionStream = "stream"
+)
+
+type requestKey struct {
+	route  string
+	method string
+	status int
+}
+
+type latencyKey struct {
+	route  string
+	method string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Metrics collects the proxy's request metrics and writes them in the Prometheus text format
+type Metrics struct {
+	mu          sync.Mutex
+	requests    map[requestKey]uint64
+	latencies   map[latencyKey]*histogram
+	connections map[string]int64
+	denied      uint64
+	upstreamErr uint64
+}
+
+// NewMetrics creates an empty metrics collector
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:    make(map[requestKey]uint64),
+		latencies:   make(map[latencyKey]*histogram),
+		connections: map[string]int64{ConnectionHijacked: 0, ConnectionStream: 0},
+	}
+}
+
+// ObserveRequest records a finished request, route is the policy endpoint that allowed it so
+// that callers cannot create label values
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{route, method, status}]++
+
+	key := latencyKey{route, method}
+	h, ok := m.latencies[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latencies[key] = h
+	}
+
+	seconds := duration.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// AddConnection changes the number of active connections of kind by delta
+func (m *Metrics) AddConnection(kind string, delta int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.connections[kind] += delta
+}
+
+// Denied counts a request rejected by the policy
+func (m *Metrics) Denied() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.denied++
+}
+
+// UpstreamError counts a request that failed to reach the Docker socket
+func (m *Metrics) UpstreamError() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.upstreamErr++
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP socket_proxy_requests_total Docker API requests by route, method and status.")
+	fmt.Fprintln(w, "# TYPE socket_proxy_requests_total counter")
+	requestKeys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	slices.SortFunc(requestKeys, func(a, b requestKey) int {
+		return cmp.Or(strings.Compare(a.route, b.route), strings.Compare(a.method, b.method), cmp.Compare(a.status, b.status))
+	})
+	for _, key := range requestKeys {
+		fmt.Fprintf(w, "socket_proxy_requests_total{route=%q,method=%q,status=\"%d\"} %d\n", key.route, key.method, key.status, m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP socket_proxy_request_duration_seconds Docker API request latency by route and method.")
+	fmt.Fprintln(w, "# TYPE socket_proxy_request_duration_seconds histogram")
+	latencyKeys := make([]latencyKey, 0, len(m.latencies))
+	for key := range m.latencies {
+		latencyKeys = append(latencyKeys, key)
+	}
+	slices.SortFunc(latencyKeys, func(a, b latencyKey) int {
+		return cmp.Or(strings.Compare(a.route, b.route), strings.Compare(a.method, b.method))
+	})
+	for _, key := range latencyKeys {
+		h := m.latencies[key]
+		labels := fmt.Sprintf("route=%q,method=%q", key.route, key.method)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "socket_proxy_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "socket_proxy_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "socket_proxy_request_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(w, "socket_proxy_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP socket_proxy_active_connections Active hijacked connections and streamed responses.")
+	fmt.Fprintln(w, "# TYPE socket_proxy_active_connections gauge")
+	for _, kind := range []string{ConnectionHijacked, ConnectionStream} {
+		fmt.Fprintf(w, "socket_proxy_active_connections{kind=%q} %d\n", kind, m.connections[kind])
+	}
+
+	fmt.Fprintln(w, "# HELP socket_proxy_denied_requests_total Requests rejected by the access policy.")
+	fmt.Fprintln(w, "# TYPE socket_proxy_denied_requests_total counter")
+	fmt.Fprintf(w, "socket_proxy_denied_requests_total %d\n", m.denied)
+
+	fmt.Fprintln(w, "# HELP socket_proxy_upstream_errors_total Requests that failed to reach the Docker socket.")
+	fmt.Fprintln(w, "# TYPE socket_proxy_upstream_errors_total counter")
+	fmt.Fprintf(w, "socket_proxy_upstream_errors_total %d\n", m.upstreamErr)
+}
+
+// Route returns the Docker API route of path with IDs and names replaced
+func Route(path string) string {
+	segments := strings.Split(strings.Trim(versionPrefix.ReplaceAllString(path, "/"), "/"), "/")
+	if len(segments) == 0 || segments[0] == "" {
+		return "/"
+	}
+
+	resource := segments[0]
+	switch {
+	case len(segments) == 1:
+		return "/" + resource
+	case len(segments) == 2 && staticRoutes[segments[1]]:
+		return "/" + resource + "/" + segments[1]
+	case resource == "images":
+		// Image names may contain slashes, the action is the last segment
+		if action := segments[len(segments)-1]; imageActions[action] {
+			return "/images/{name}/" + action
+		}
+
+		return "/images/{name}"
+	case len(segments) == 2:
+		return "/" + resource + "/{id}"
+	}
+
+	return "/" + resource + "/{id}/" + segments[2]
+}
+
+var staticRoutes = map[string]bool{
+	"json":       true,
+	"create":     true,
+	"prune":      true,
+	"load":       true,
+	"search":     true,
+	"get":        true,
+	"df":         true,
+	"privileges": true,
+}
+
+var imageActions = map[string]bool{
+	"json":    true,
+	"history": true,
+	"push":    true,
+	"tag":     true,
+	"get":     true,
+}
+
+// MetricsHandler serves the metrics, extra writes additional metrics such as the tailnet state
+func MetricsHandler(m *Metrics, extra func(w io.Writer)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WritePrometheus(w)
+		if extra != nil {
+			extra(w)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package socketproxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// PresetReadOnly allows inspecting containers, images, networks and volumes without changing them
+	PresetReadOnly = "read-only"
+	// PresetFull allows every Docker API call
+	PresetFull = "full"
+)
+
+// versionPrefix matches the optional API version in front of Docker API paths, e.g. /v1.45
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+(\.[0-9]+)?/`)
+
+// Endpoint allows methods on the Docker API paths matching Path. A "*" segment matches one path
+// segment, a "**" segment matches any number of them. Paths are matched without the API version.
+type Endpoint struct {
+	Methods []string `mapstructure:"methods"`
+	Path    string   `mapstructure:"path"`
+}
+
+// Rule grants callers matching Users or Tags access to the endpoints of Preset and Allow.
+// "*" in Users matches every caller.
+type Rule struct {
+	Users  []string   `mapstructure:"users"`
+	Tags   []string   `mapstructure:"tags"`
+	Preset string     `mapstructure:"preset"`
+	Allow  []Endpoint `mapstructure:"allow"`
+}
+
+// Policy is an allowlist of Docker API calls, requests matching no rule are denied
+type Policy struct {
+	Rules []Rule `mapstructure:"rules"`
+}
+
+var presets = map[string][]Endpoint{
+	PresetReadOnly: {
+		{Methods: []string{http.MethodGet, http.MethodHead}, Path: "/_ping"},
+		{Methods: []string{http.MethodGet}, Path: "/version"},
+		{Methods: []string{http.MethodGet}, Path: "/info"},
+		{Methods: []string{http.MethodGet}, Path: "/events"},
+		{Methods: []string{http.MethodGet}, Path: "/system/df"},
+		{Methods: []string{http.MethodGet}, Path: "/containers/json"},
+		{Methods: []string{http.MethodGet}, Path: "/containers/*/json"},
+		{Methods: []string{http.MethodGet}, Path: "/containers/*/logs"},
+		{Methods: []string{http.MethodGet}, Path: "/containers/*/stats"},
+		{Methods: []string{http.MethodGet}, Path: "/containers/*/top"},
+		{Methods: []string{http.MethodGet}, Path: "/images/json"},
+		{Methods: []string{http.MethodGet}, Path: "/images/**/json"},
+		{Methods: []string{http.MethodGet}, Path: "/images/**/history"},
+		{Methods: []string{http.MethodGet}, Path: "/networks"},
+		{Methods: []string{http.MethodGet}, Path: "/networks/*"},
+		{Methods: []string{http.MethodGet}, Path: "/volumes"},
+		{Methods: []string{http.MethodGet}, Path: "/volumes/*"},
+	},
+	PresetFull: {
+		{Methods: []string{"*"}, Path: "/**"},
+	},
+}
+
+// PresetPolicy returns a policy granting every caller the endpoints of preset
+func PresetPolicy(preset string) (*Policy, error) {
+	policy := &Policy{Rules: []Rule{{Users: []string{"*"}, Preset: preset}}}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// LoadPolicy reads a policy from a YAML or JSON file
+func LoadPolicy(path string) (*Policy, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var policy Policy
+	if err := v.Unmarshal(&policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// Validate checks that every rule names its callers and grants at least one endpoint
+func (p *Policy) Validate() error {
+	if len(p.Rules) == 0 {
+		return fmt.Errorf("policy has no rules")
+	}
+
+	for i, rule := range p.Rules {
+		if len(rule.Users) == 0 && len(rule.Tags) == 0 {
+			return fmt.Errorf("policy rule %d: users or tags are required", i+1)
+		}
+
+		if _, ok := presets[rule.Preset]; rule.Preset != "" && !ok {
+			return fmt.Errorf("policy rule %d: unknown preset %q, use %s or %s", i+1, rule.Preset, PresetReadOnly, PresetFull)
+		}
+
+		if rule.Preset == "" && len(rule.Allow) == 0 {
+			return fmt.Errorf("policy rule %d: preset or allow is required", i+1)
+		}
+
+		for _, endpoint := range rule.Allow {
+			if !strings.HasPrefix(endpoint.Path, "/") || len(endpoint.Methods) == 0 {
+				return fmt.Errorf("policy rule %d: endpoints need methods and a path starting with /", i+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Allowed reports whether caller may call method on the Docker API path
+func (p *Policy) Allowed(caller Caller, method, path string) bool {
+	_, ok := p.Match(caller, method, path)
+	return ok
+}
+
+// Match returns the path pattern of the first endpoint allowing caller to call method on the
+// Docker API path, false when no rule allows it
+func (p *Policy) Match(caller Caller, method, path string) (string, bool) {
+	path = "/" + strings.TrimPrefix(versionPrefix.ReplaceAllString(path, "/"), "/")
+
+	for _, rule := range p.Rules {
+		if !rule.matches(caller) {
+			continue
+		}
+
+		endpoints := slices.Concat(presets[rule.Preset], rule.Allow)
+		for _, endpoint := range endpoints {
+			if endpoint.matches(method, path) {
+				return endpoint.Path, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func (r Rule) matches(caller Caller) bool {
+	if slices.Contains(r.Users, "*") || (caller.User != "" && slices.Contains(r.Users, caller.User)) {
+		return true
+	}
+
+	for _, tag := range caller.Tags {
+		if slices.Contains(r.Tags, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e Endpoint) matches(method, path string) bool {
+	if !slices.Contains(e.Methods, "*") && !slices.ContainsFunc(e.Methods, func(m string) bool { return strings.EqualFold(m, method) }) {
+		return false
+	}
+
+	return matchSegments(strings.Split(strings.Trim(e.Path, "/"), "/"), strings.Split(strings.Trim(path, "/"), "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 1; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(segments) == 0 || (pattern[0] != "*" && pattern[0] != segments[0]) {
+		return false
+	}
+
+	return matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,113 @@
+package socketproxy
+
+import (
+	"net/http"
+	"path"
+	"testing"
+)
+
+func TestPolicyMatch(t *testing.T) {
+	policy := &Policy{Rules: []Rule{
+		{Users: []string{"alice@example.com"}, Preset: PresetReadOnly},
+		{Tags: []string{"tag:deployer"}, Allow: []Endpoint{
+			{Methods: []string{"POST"}, Path: "/containers/*/restart"},
+			{Methods: []string{"post"}, Path: "/images/create"},
+			{Methods: []string{"*"}, Path: "/volumes/**"},
+		}},
+	}}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := Caller{User: "alice@example.com"}
+	deployer := Caller{Node: "ci", Tags: []string{"tag:deployer"}}
+	stranger := Caller{User: "mallory@example.com"}
+
+	tests := []struct {
+		name   string
+		caller Caller
+		method string
+		path   string
+		route  string
+	}{
+		{"read-only list", alice, http.MethodGet, "/containers/json", "/containers/json"},
+		{"read-only with API version", alice, http.MethodGet, "/v1.45/containers/abc/json", "/containers/*/json"},
+		{"read-only image with slashes", alice, http.MethodGet, "/images/ghcr.io/traefik/whoami:latest/json", "/images/**/json"},
+		{"read-only head ping", alice, http.MethodHead, "/_ping", "/_ping"},
+		{"read-only create", alice, http.MethodPost, "/containers/create", ""},
+		{"read-only exec", alice, http.MethodPost, "/containers/abc/exec", ""},
+		{"read-only other user", stranger, http.MethodGet, "/containers/json", ""},
+		{"tag restart", deployer, http.MethodPost, "/v1.43/containers/abc/restart", "/containers/*/restart"},
+		{"tag method case-insensitive", deployer, http.MethodPost, "/images/create", "/images/create"},
+		{"tag wrong method", deployer, http.MethodDelete, "/containers/abc/restart", ""},
+		{"tag star segment is one segment", deployer, http.MethodPost, "/containers/a/b/restart", ""},
+		{"tag double star", deployer, http.MethodDelete, "/volumes/data/x", "/volumes/**"},
+		{"tag double star needs a segment", deployer, http.MethodGet, "/volumes", ""},
+		{"tag not read-only", deployer, http.MethodGet, "/containers/json", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, ok := policy.Match(tt.caller, tt.method, tt.path)
+			if ok != (tt.route != "") || route != tt.route {
+				t.Errorf("Match(%s %s) = %q, %v, want %q", tt.method, tt.path, route, ok, tt.route)
+			}
+		})
+	}
+}
+
+// TestPolicyMatchCleanedPaths checks paths as the proxy matches them, after path.Clean, so that
+// dot segments cannot reach endpoints outside of an allowed prefix
+func TestPolicyMatchCleanedPaths(t *testing.T) {
+	policy, err := PresetPolicy(PresetReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		method  string
+		allowed bool
+	}{
+		{"/containers/abc/json", http.MethodGet, true},
+		{"/containers/abc/../../images/create", http.MethodGet, false},
+		{"/containers/abc/json/../../../build", http.MethodGet, false},
+		{"/images/abc/../../containers/json", http.MethodGet, true},
+		{"/containers/./abc/./json", http.MethodGet, true},
+		{"//containers//json", http.MethodGet, true},
+		{"/v1.45/../exec/abc/start", http.MethodGet, false},
+		{"/volumes/../../../etc/passwd", http.MethodGet, false},
+	}
+
+	for _, tt := range tests {
+		cleaned := path.Clean("/" + tt.path)
+		if got := policy.Allowed(Caller{User: "alice"}, tt.method, cleaned); got != tt.allowed {
+			t.Errorf("Allowed(%s) as %s = %v, want %v", tt.path, cleaned, got, tt.allowed)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		valid  bool
+	}{
+		{"no rules", Policy{}, false},
+		{"no callers", Policy{Rules: []Rule{{Preset: PresetFull}}}, false},
+		{"unknown preset", Policy{Rules: []Rule{{Users: []string{"*"}, Preset: "admin"}}}, false},
+		{"no endpoints", Policy{Rules: []Rule{{Users: []string{"*"}}}}, false},
+		{"relative path", Policy{Rules: []Rule{{Users: []string{"*"}, Allow: []Endpoint{{Methods: []string{"GET"}, Path: "info"}}}}}, false},
+		{"no methods", Policy{Rules: []Rule{{Users: []string{"*"}, Allow: []Endpoint{{Path: "/info"}}}}}, false},
+		{"preset", Policy{Rules: []Rule{{Tags: []string{"tag:ci"}, Preset: PresetReadOnly}}}, true},
+		{"allow", Policy{Rules: []Rule{{Users: []string{"*"}, Allow: []Endpoint{{Methods: []string{"GET"}, Path: "/info"}}}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package socketproxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/client/local"
+)
+
+// Caller identifies the client of a proxied request
+type Caller struct {
+	User string
+	Node string
+	Tags []string
+}
+
+// Identifier resolves the caller of a request
+type Identifier func(r *http.Request) (Caller, error)
+
+// TailnetIdentifier identifies callers through tsnet's WhoIs. Tagged nodes are identified by their
+// tags only, their user profile is a placeholder shared by all tagged devices.
+func TailnetIdentifier(lc *local.Client) Identifier {
+	return func(r *http.Request) (Caller, error) {
+		who, err := lc.WhoIs(r.Context(), r.RemoteAddr)
+		if err != nil {
+			return Caller{}, fmt.Errorf("failed to identify %s: %w", r.RemoteAddr, err)
+		}
+
+		var caller Caller
+		if who.Node != nil {
+			caller.Node = who.Node.ComputedName
+			caller.Tags = who.Node.Tags
+		}
+
+		if who.UserProfile != nil && len(caller.Tags) == 0 {
+			caller.User = who.UserProfile.LoginName
+		}
+
+		return caller, nil
+	}
+}
+
+// Proxy forwards the Docker API calls allowed by its policy to a Docker socket
+type Proxy struct {
+	policy   *Policy
+	identify Identifier
+	audit    *slog.Logger
+	metrics  *Metrics
+	upstream *httputil.ReverseProxy
+}
+
+// NewProxy creates a proxy to the Docker socket at socketPath. Mutating and denied requests are
+// written to audit, allowed requests are counted in metrics.
+func NewProxy(socketPath string, policy *Policy, identify Identifier, audit *slog.Logger, metrics *Metrics) *Proxy {
+	socketURLDummy, _ := url.Parse("http://localhost") // dummy URL - we use the unix socket
+	upstream := httputil.NewSingleHostReverseProxy(socketURLDummy)
+	upstream.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}
+
+	upstream.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, context.Canceled) {
+			// the caller went away, there is no one to answer
+			return
+		}
+
+		metrics.UpstreamError()
+		slog.Error("docker socket request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusBadGateway, "docker socket is unavailable")
+	}
+
+	return &Proxy{
+		policy:   policy,
+		identify: identify,
+		audit:    audit,
+		metrics:  metrics,
+		upstream: upstream,
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	// The policy is matched against the cleaned path, forward exactly that path
+	r.URL.Path = path.Clean("/" + r.URL.Path)
+	r.URL.RawPath = ""
+
+	id := requestID()
+	caller, err := p.identify(r)
+	if err != nil {
+		slog.Warn("rejecting unidentified caller", "remote", r.RemoteAddr, "error", err)
+		p.metrics.Denied()
+		p.decision(r, id, caller, false)
+		writeError(w, http.StatusForbidden, "caller could not be identified")
+		return
+	}
+
+	route, allowed := p.policy.Match(caller, r.Method, r.URL.Path)
+	if !allowed {
+		p.metrics.Denied()
+		p.decision(r, id, caller, false)
+		writeError(w, http.StatusForbidden, fmt.Sprintf("%s %s is not allowed by the socket-proxy policy", r.Method, r.URL.Path))
+		return
+	}
+
+	// Mutating calls are logged before they are forwarded, so that exec and attach sessions are
+	// on record while they run, even if the proxy dies before they end
+	audited := mutating(r.Method)
+	if audited {
+		p.decision(r, id, caller, true)
+	}
+
+	// Upgraded connections are hijacked, the status line is written without WriteHeader
+	rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK, metrics: p.metrics}
+	if r.Header.Get("Upgrade") != "" {
+		rw.status = http.StatusSwitchingProtocols
+	}
+
+	if streaming(r) {
+		p.metrics.AddConnection(ConnectionStream, 1)
+		defer p.metrics.AddConnection(ConnectionStream, -1)
+	}
+
+	p.upstream.ServeHTTP(rw, r)
+	p.metrics.ObserveRequest(route, r.Method, rw.status, time.Since(start))
+
+	if audited {
+		p.audit.Info("docker api request completed",
+			"id", id,
+			"user", caller.User,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rw.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
+
+// decision writes whether a request is allowed to the audit log, id correlates it with the
+// line written once an allowed request completes
+func (p *Proxy) decision(r *http.Request, id string, caller Caller, allowed bool) {
+	p.audit.Info("docker api request",
+		"id", id,
+		"user", caller.User,
+		"node", caller.Node,
+		"tags", caller.Tags,
+		"remote", r.RemoteAddr,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"query", r.URL.RawQuery,
+		"allowed", allowed,
+	)
+}
+
+func requestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// writeError answers with the JSON error body the Docker client shows to its user
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// streaming reports whether the response is streamed until the caller disconnects
+func streaming(r *http.Request) bool {
+	follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+	route := Route(r.URL.Path)
+
+	return route == "/events" || (follow && route == "/containers/{id}/logs")
+}
+
+func mutating(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+
+	return true
+}
+
+// statusRecorder captures the response status and counts hijacked connections. Unwrap lets the
+// reverse proxy reach the flusher of the underlying writer for streamed logs.
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	metrics *Metrics
+}
+
+// Hijack takes over the connection for attach and exec, it is counted until closed
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(s.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.metrics.AddConnection(ConnectionHijacked, 1)
+	return &countedConn{Conn: conn, metrics: s.metrics}, brw, nil
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+type countedConn struct {
+	net.Conn
+	metrics *Metrics
+	once    sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.metrics.AddConnection(ConnectionHijacked, -1) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,416 @@
+package socketproxy
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDocker serves a minimal Docker API on a unix socket and records the calls it receives
+type fakeDocker struct {
+	socketPath string
+	mu         sync.Mutex
+	calls      []string
+}
+
+func startFakeDocker(t *testing.T) *fakeDocker {
+	t.Helper()
+
+	// unix socket paths are limited to about 100 bytes, t.TempDir can be longer
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	d := &fakeDocker{socketPath: filepath.Join(dir, "docker.sock")}
+	l, err := net.Listen("unix", d.socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		d.calls = append(d.calls, r.Method+" "+r.URL.Path)
+		d.mu.Unlock()
+
+		if r.URL.Path == "/_ping" {
+			_, _ = io.WriteString(w, "OK")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"Id":"abc"}`)
+	})}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return d
+}
+
+func (d *fakeDocker) Calls() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string(nil), d.calls...)
+}
+
+// auditBuffer collects the audit log, lines are written by the handler after the response
+type auditBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (a *auditBuffer) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.buf.Write(p)
+}
+
+// entries waits until the audit log has n lines and returns them
+func (a *auditBuffer) entries(t *testing.T, n int) []map[string]any {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		a.mu.Lock()
+		data := a.buf.String()
+		a.mu.Unlock()
+
+		lines := strings.Split(strings.TrimSpace(data), "\n")
+		if data != "" && len(lines) >= n {
+			entries := make([]map[string]any, 0, len(lines))
+			for _, line := range lines {
+				var entry map[string]any
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("audit line is not JSON: %q: %v", line, err)
+				}
+				entries = append(entries, entry)
+			}
+			return entries
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("audit log has %d lines, want %d:\n%s", len(lines), n, data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// headerIdentifier identifies callers by the X-User header, in place of the tailnet
+func headerIdentifier(r *http.Request) (Caller, error) {
+	return Caller{User: r.Header.Get("X-User")}, nil
+}
+
+func TestProxyPolicy(t *testing.T) {
+	docker := startFakeDocker(t)
+	policy := &Policy{Rules: []Rule{
+		{Users: []string{"*"}, Preset: PresetReadOnly},
+		{Users: []string{"deployer"}, Allow: []Endpoint{{Methods: []string{"POST"}, Path: "/containers/*/restart"}}},
+	}}
+
+	var audit auditBuffer
+	metrics := NewMetrics()
+	proxy := httptest.NewServer(NewProxy(docker.socketPath, policy, headerIdentifier, slog.New(slog.NewJSONHandler(&audit, nil)), metrics))
+	defer proxy.Close()
+
+	tests := []struct {
+		user   string
+		method string
+		path   string
+		status int
+	}{
+		{"viewer", http.MethodGet, "/v1.45/containers/json", http.StatusOK},
+		{"viewer", http.MethodPost, "/v1.45/containers/abc/restart", http.StatusForbidden},
+		{"deployer", http.MethodPost, "/v1.45/containers/abc/restart", http.StatusOK},
+		{"viewer", http.MethodGet, "/containers/abc/../../build", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, proxy.URL+tt.path, nil)
+		req.Header.Set("X-User", tt.user)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s %s: status %d, want %d: %s", tt.user, tt.method, tt.path, resp.StatusCode, tt.status, body)
+		}
+
+		if tt.status == http.StatusForbidden {
+			var docErr struct{ Message string }
+			if err := json.Unmarshal(body, &docErr); err != nil || docErr.Message == "" {
+				t.Errorf("%s %s: denied body %q is not a Docker error", tt.method, tt.path, body)
+			}
+		}
+	}
+
+	// denied calls never reach the socket
+	want := []string{"GET /v1.45/containers/json", "POST /v1.45/containers/abc/restart"}
+	if calls := docker.Calls(); strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("docker received %v, want %v", calls, want)
+	}
+
+	// two denials, then the decision and the completion of the allowed restart
+	entries := audit.entries(t, 4)
+	if len(entries) != 4 {
+		t.Fatalf("audit log has %d lines, want 4: %v", len(entries), entries)
+	}
+
+	denied := entries[0]
+	if denied["allowed"] != false || denied["user"] != "viewer" || denied["method"] != "POST" {
+		t.Errorf("denied entry = %v", denied)
+	}
+
+	decision, completed := entries[1], entries[2]
+	if decision["msg"] != "docker api request" || decision["allowed"] != true || decision["user"] != "deployer" {
+		t.Errorf("decision entry = %v", decision)
+	}
+	if completed["msg"] != "docker api request completed" || completed["id"] != decision["id"] || completed["status"] != float64(http.StatusOK) {
+		t.Errorf("completed entry = %v, decision id %v", completed, decision["id"])
+	}
+
+	if traversal := entries[3]; traversal["path"] != "/build" || traversal["allowed"] != false {
+		t.Errorf("traversal entry = %v", traversal)
+	}
+
+	var out bytes.Buffer
+	metrics.WritePrometheus(&out)
+	for _, line := range []string{
+		`socket_proxy_requests_total{route="/containers/json",method="GET",status="200"} 1`,
+		`socket_proxy_requests_total{route="/containers/*/restart",method="POST",status="200"} 1`,
+		`socket_proxy_denied_requests_total 2`,
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("metrics lack %s:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestProxySocketDown(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "missing.sock")
+	policy, _ := PresetPolicy(PresetFull)
+
+	var audit auditBuffer
+	metrics := NewMetrics()
+	proxy := httptest.NewServer(NewProxy(socketPath, policy, headerIdentifier, slog.New(slog.NewJSONHandler(&audit, nil)), metrics))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/containers/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status %d, want 502", resp.StatusCode)
+	}
+
+	var docErr struct{ Message string }
+	if err := json.NewDecoder(resp.Body).Decode(&docErr); err != nil || docErr.Message != "docker socket is unavailable" {
+		t.Errorf("body message = %q, %v", docErr.Message, err)
+	}
+
+	var out bytes.Buffer
+	metrics.WritePrometheus(&out)
+	if !strings.Contains(out.String(), "socket_proxy_upstream_errors_total 1") {
+		t.Errorf("upstream error not counted:\n%s", out.String())
+	}
+
+	health := httptest.NewRecorder()
+	HealthHandler(SocketHealthCheck(socketPath)).ServeHTTP(health, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if health.Code != http.StatusServiceUnavailable {
+		t.Errorf("/healthz status %d, want 503", health.Code)
+	}
+}
+
+func TestHealthAndMetricsHandlers(t *testing.T) {
+	docker := startFakeDocker(t)
+
+	mux := http.NewServeMux()
+	metrics := NewMetrics()
+	metrics.ObserveRequest("/containers/json", http.MethodGet, http.StatusOK, 20*time.Millisecond)
+	mux.Handle("/healthz", HealthHandler(SocketHealthCheck(docker.socketPath)))
+	mux.Handle("/metrics", MetricsHandler(metrics, func(w io.Writer) {
+		_, _ = io.WriteString(w, "socket_proxy_tailnet_state{state=\"Running\"} 1\n")
+	}))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok\n" {
+		t.Errorf("/healthz = %d %q", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("/metrics content type %q", ct)
+	}
+	for _, line := range []string{
+		`socket_proxy_request_duration_seconds_bucket{route="/containers/json",method="GET",le="0.025"} 1`,
+		`socket_proxy_request_duration_seconds_bucket{route="/containers/json",method="GET",le="0.01"} 0`,
+		`socket_proxy_active_connections{kind="hijacked"} 0`,
+		`socket_proxy_tailnet_state{state="Running"} 1`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("/metrics lacks %s:\n%s", line, body)
+		}
+	}
+}
+
+func TestProxyClientCertificateIdentity(t *testing.T) {
+	docker := startFakeDocker(t)
+	dir := t.TempDir()
+
+	ca, caKey := newCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", ca.Raw)
+
+	server, serverKey := newCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "socket-proxy"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writePEM(t, filepath.Join(dir, "server.pem"), "CERTIFICATE", server.Raw)
+	keyDER, _ := x509.MarshalECPrivateKey(serverKey)
+	writePEM(t, filepath.Join(dir, "server-key.pem"), "EC PRIVATE KEY", keyDER)
+
+	tlsConfig, err := ServerTLSConfig(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"), filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &Policy{Rules: []Rule{{Tags: []string{"deployers"}, Preset: PresetFull}}}
+	var audit auditBuffer
+	proxy := httptest.NewUnstartedServer(NewProxy(docker.socketPath, policy, CertificateIdentifier(), slog.New(slog.NewJSONHandler(&audit, nil)), NewMetrics()))
+	proxy.TLS = tlsConfig
+	proxy.StartTLS()
+	defer proxy.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientFor := func(cn string, ou []string) *http.Client {
+		cert, key := newCertificate(t, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: cn, OrganizationalUnit: ou},
+			DNSNames:    []string{cn + "-laptop"},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, ca, caKey)
+
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}},
+		}}}
+	}
+
+	resp, err := clientFor("alice", []string{"deployers"}).Post(proxy.URL+"/containers/abc/restart", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("alice: status %d, want 200", resp.StatusCode)
+	}
+
+	resp, err = clientFor("bob", []string{"viewers"}).Post(proxy.URL+"/containers/abc/restart", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("bob: status %d, want 403", resp.StatusCode)
+	}
+
+	// callers without a certificate are rejected by the TLS handshake
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if resp, err := anonymous.Get(proxy.URL + "/containers/json"); err == nil {
+		resp.Body.Close()
+		t.Errorf("anonymous caller got status %d, want a handshake error", resp.StatusCode)
+	}
+
+	entries := audit.entries(t, 3)
+	alice, bob := entries[0], entries[2]
+	if alice["user"] != "alice" || alice["node"] != "alice-laptop" || alice["allowed"] != true {
+		t.Errorf("alice entry = %v", alice)
+	}
+	if tags, _ := alice["tags"].([]any); len(tags) != 1 || tags[0] != "deployers" {
+		t.Errorf("alice tags = %v, want [deployers]", alice["tags"])
+	}
+	if bob["user"] != "bob" || bob["allowed"] != false {
+		t.Errorf("bob entry = %v", bob)
+	}
+}
+
+// newCertificate creates a certificate from template signed by parent, self-signed without parent
+func newCertificate(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,60 @@
+package socketproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// ServerTLSConfig returns a TLS config requiring client certificates signed by the CA in clientCAFile
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" || clientCAFile == "" {
+		return nil, fmt.Errorf("a server certificate, key and client CA are required")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in client CA %s", clientCAFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// CertificateIdentifier identifies callers by their verified client certificate. The common name is
+// the user, organizational units are the tags, and the first DNS name, if any, is the node.
+func CertificateIdentifier() Identifier {
+	return func(r *http.Request) (Caller, error) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return Caller{}, fmt.Errorf("no verified client certificate from %s", r.RemoteAddr)
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		caller := Caller{
+			User: cert.Subject.CommonName,
+			Tags: cert.Subject.OrganizationalUnit,
+		}
+
+		if len(cert.DNSNames) > 0 {
+			caller.Node = cert.DNSNames[0]
+		}
+
+		return caller, nil
+	}
+}